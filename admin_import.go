@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwerty-dvorak/gocli/mailaddr"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// AdminRecord is the portable form of an admin used by import and export.
+// Admins are identified by their user's email so files can be moved
+// between databases where the IDs differ.
+type AdminRecord struct {
+	Email                    string `json:"email" yaml:"email"`
+	CheckinAccess            bool   `json:"checkin_access" yaml:"checkin_access"`
+	AnticheatAccess          bool   `json:"anticheat_access" yaml:"anticheat_access"`
+	QrmgmtAccess             bool   `json:"qrmgmt_access" yaml:"qrmgmt_access"`
+	QuestionManagementAccess bool   `json:"question_management_access" yaml:"question_management_access"`
+	CommunicationAccess      bool   `json:"communication_access" yaml:"communication_access"`
+
+	source string
+}
+
+var adminColumns = []string{
+	"email",
+	"checkin_access",
+	"anticheat_access",
+	"qrmgmt_access",
+	"question_management_access",
+	"communication_access",
+}
+
+func NewAdminRecord(user store.User, admin store.Admin) AdminRecord {
+	return AdminRecord{
+		Email:                    user.Email,
+		CheckinAccess:            admin.CheckinAccess,
+		AnticheatAccess:          admin.AnticheatAccess,
+		QrmgmtAccess:             admin.QrmgmtAccess,
+		QuestionManagementAccess: admin.QuestionManagementAccess,
+		CommunicationAccess:      admin.CommunicationAccess,
+	}
+}
+
+// accessNames are the display names of the permissions, in the same order
+// as adminColumns[1:] and AdminRecord.permissions.
+var accessNames = []string{
+	"Checkin",
+	"Anticheat",
+	"Qr Management",
+	"Question Management",
+	"Communication",
+}
+
+// apply copies the permissions of the record onto admin.
+func (r AdminRecord) apply(admin *store.Admin) {
+	admin.CheckinAccess = r.CheckinAccess
+	admin.AnticheatAccess = r.AnticheatAccess
+	admin.QrmgmtAccess = r.QrmgmtAccess
+	admin.QuestionManagementAccess = r.QuestionManagementAccess
+	admin.CommunicationAccess = r.CommunicationAccess
+}
+
+func (r AdminRecord) permissions() []bool {
+	return []bool{r.CheckinAccess, r.AnticheatAccess, r.QrmgmtAccess,
+		r.QuestionManagementAccess, r.CommunicationAccess}
+}
+
+func isJSONFile(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".json")
+}
+
+// parseAccess accepts the same answers as askForAccess plus the usual
+// spreadsheet spellings of a boolean.
+func parseAccess(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "y", "yes", "t", "true", "1":
+		return true, nil
+	case "n", "no", "f", "false", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid access value %q", value)
+}
+
+func readAdminRecords(filename string) ([]AdminRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if isJSONFile(filename) {
+		var records []AdminRecord
+		if err := json.NewDecoder(file).Decode(&records); err != nil {
+			return nil, fmt.Errorf("invalid json: %w", err)
+		}
+		for i := range records {
+			records[i].source = fmt.Sprintf("record %d", i+1)
+		}
+		return records, nil
+	}
+	return readAdminCSV(file)
+}
+
+func readAdminCSV(r io.Reader) ([]AdminRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("file is empty")
+		}
+		return nil, err
+	}
+	index := make(map[string]int)
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range adminColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+
+	var records []AdminRecord
+	var errs []error
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		record := AdminRecord{
+			Email:  strings.TrimSpace(row[index["email"]]),
+			source: fmt.Sprintf("line %d", line),
+		}
+		fields := []*bool{&record.CheckinAccess, &record.AnticheatAccess, &record.QrmgmtAccess,
+			&record.QuestionManagementAccess, &record.CommunicationAccess}
+		for i, field := range fields {
+			column := adminColumns[i+1]
+			*field, err = parseAccess(row[index[column]])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("line %d: %s: %w", line, column, err))
+			}
+		}
+		records = append(records, record)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return records, nil
+}
+
+// ImportAdmins creates or updates an admin for every row of a csv or json
+// file. Every row is validated before anything is written, and the writes
+// happen in a single transaction.
+func ImportAdmins(filename string, st store.Store) (added int, updated int, err error) {
+	records, err := readAdminRecords(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	users := make([]*store.User, len(records))
+	seen := make(map[string]string)
+	var errs []error
+	for i, record := range records {
+		email, err := mailaddr.Normalize(record.Email)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", record.source, err))
+			continue
+		}
+		records[i].Email, record.Email = email, email
+		key := emailKey(email)
+		if first, ok := seen[key]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate email %s (first seen on %s)", record.source, record.Email, first))
+			continue
+		}
+		seen[key] = record.source
+		user, err := findUser(email, st)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", record.source, record.Email, err))
+			continue
+		}
+		users[i] = user
+	}
+	if len(errs) > 0 {
+		return 0, 0, errors.Join(errs...)
+	}
+
+	err = st.Tx(func(tx store.Store) error {
+		for i, record := range records {
+			created, err := upsertAdmin(*users[i], record, tx)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", record.source, record.Email, err)
+			}
+			if created {
+				added++
+			} else {
+				updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return added, updated, nil
+}
+
+// upsertAdmin gives user the permissions in record, creating the admin if
+// the user is not one yet. It reports whether a new admin was created.
+func upsertAdmin(user store.User, record AdminRecord, st store.Store) (bool, error) {
+	admin, err := st.GetAdmin(user.ID)
+	if err == nil {
+		record.apply(admin)
+		return false, st.UpdateAdmin(admin)
+	}
+	if !errors.Is(err, store.ErrAdminNotFound) {
+		return false, err
+	}
+
+	created := store.NewAdmin(user)
+	record.apply(&created)
+	if err := st.CreateAdmin(&created); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListAdminRecords returns every admin ordered by email.
+func ListAdminRecords(st store.Store) ([]AdminRecord, error) {
+	admins, err := st.ListAdmins()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]AdminRecord, len(admins))
+	for i, admin := range admins {
+		records[i] = NewAdminRecord(admin.User, admin)
+	}
+	return records, nil
+}
+
+// ExportAdmins writes every admin to filename in the format accepted by
+// ImportAdmins. An empty filename or "-" writes csv to stdout.
+func ExportAdmins(filename string, st store.Store) (int, error) {
+	records, err := ListAdminRecords(st)
+	if err != nil {
+		return 0, err
+	}
+
+	var out io.Writer = console.Out
+	if filename != "" && filename != "-" {
+		file, err := os.Create(filename)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if isJSONFile(filename) {
+		if records == nil {
+			records = []AdminRecord{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return len(records), encoder.Encode(records)
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Write(adminColumns)
+	for _, record := range records {
+		row := []string{record.Email}
+		for _, access := range record.permissions() {
+			row = append(row, fmt.Sprintf("%t", access))
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return len(records), writer.Error()
+}
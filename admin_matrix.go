@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// matrixColumns are the short names of the permissions in accessNames
+// order, to keep the matrix narrow.
+var matrixColumns = []string{"Checkin", "Anticheat", "QR", "Question Mgmt", "Communication"}
+
+// printAdminMatrix prints every admin with a ✓ or ✗ per permission and
+// how many admins have each.
+func printAdminMatrix(st store.Store) error {
+	admins, err := st.ListAdmins()
+	if err != nil {
+		return err
+	}
+
+	table := newTable(append([]string{"Name", "Email"}, matrixColumns...)...)
+	totals := make([]int, len(matrixColumns))
+	for _, admin := range admins {
+		row := []string{admin.User.Name, admin.User.Email}
+		for i, access := range NewAdminRecord(admin.User, admin).permissions() {
+			if access {
+				totals[i]++
+				row = append(row, "✓")
+			} else {
+				row = append(row, "✗")
+			}
+		}
+		table.AddRow("", row...)
+	}
+	table.Footer = []string{"Total", fmt.Sprintf("%d admins", len(admins))}
+	for _, total := range totals {
+		table.Footer = append(table.Footer, fmt.Sprintf("%d", total))
+	}
+
+	console.Printf("%sPermissions of every admin:%s\n", cyan, reset)
+	console.PrintTable(table)
+	return nil
+}
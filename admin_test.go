@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/qwerty-dvorak/gocli/store"
+	"github.com/qwerty-dvorak/gocli/ui"
+)
+
+func TestAddAdmin(t *testing.T) {
+	db, st := openTestDB(t)
+	user := addTestUser(t, db, "alice@example.com")
+
+	var err error
+	withStdio(t, "y\nn\nY\n\nn\n", func() { err = AddAdmin(user.Email, st) })
+	if err != nil {
+		t.Fatalf("AddAdmin: %v", err)
+	}
+	admin, err := st.GetAdmin(user.ID)
+	if err != nil {
+		t.Fatalf("GetAdmin: %v", err)
+	}
+	got := NewAdminRecord(user, *admin)
+	want := AdminRecord{Email: user.Email, CheckinAccess: true, QrmgmtAccess: true}
+	if got != want {
+		t.Errorf("admin = %+v, want %+v", got, want)
+	}
+
+	withStdio(t, "", func() { err = AddAdmin(user.Email, st) })
+	if !errors.Is(err, store.ErrAdminExists) {
+		t.Errorf("adding an admin twice: got %v, want %v", err, store.ErrAdminExists)
+	}
+}
+
+func TestAddAdminUnknownUser(t *testing.T) {
+	_, st := openTestDB(t)
+	var err error
+	withStdio(t, "", func() { err = AddAdmin("nobody@example.com", st) })
+	if !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("got %v, want %v", err, store.ErrUserNotFound)
+	}
+}
+
+func TestAddAdminNormalizesEmail(t *testing.T) {
+	db, st := openTestDB(t)
+	user := addTestUser(t, db, "alice@example.com")
+
+	var err error
+	withStdio(t, "y\nn\nn\nn\nn\n", func() { err = AddAdmin("  Alice@EXAMPLE.com ", st) })
+	if err != nil {
+		t.Fatalf("AddAdmin: %v", err)
+	}
+	if _, err := st.GetAdmin(user.ID); err != nil {
+		t.Errorf("GetAdmin: %v", err)
+	}
+
+	withStdio(t, "", func() { err = AddAdmin("alice@", st) })
+	if err == nil || !strings.Contains(err.Error(), "invalid email") {
+		t.Errorf("adding an invalid email: got %v", err)
+	}
+}
+
+func TestDeleteAdminCascadesToQrData(t *testing.T) {
+	db, st := openTestDB(t)
+	user := addTestUser(t, db, "alice@example.com")
+	admin := store.NewAdmin(user)
+	if err := st.CreateAdmin(&admin); err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO qr_data (id, admin_id) VALUES ($1, $2)`, uuid.New().String(), admin.ID); err != nil {
+		t.Fatalf("adding qr_data: %v", err)
+	}
+
+	if err := DeleteAdmin(user.Email, st); err != nil {
+		t.Fatalf("DeleteAdmin: %v", err)
+	}
+	if _, err := st.GetAdmin(user.ID); !errors.Is(err, store.ErrAdminNotFound) {
+		t.Errorf("GetAdmin after delete: got %v, want %v", err, store.ErrAdminNotFound)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM qr_data`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d qr_data rows left after deleting their admin", count)
+	}
+
+	if err := DeleteAdmin(user.Email, st); !errors.Is(err, store.ErrAdminNotFound) {
+		t.Errorf("deleting twice: got %v, want %v", err, store.ErrAdminNotFound)
+	}
+}
+
+func TestModifyAdminKeepsUnansweredPermissions(t *testing.T) {
+	db, st := openTestDB(t)
+	user := addTestUser(t, db, "alice@example.com")
+	admin := store.NewAdmin(user)
+	admin.CheckinAccess = true
+	admin.CommunicationAccess = true
+	if err := st.CreateAdmin(&admin); err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+
+	// Leave checkin, qr management and question management unanswered.
+	var err error
+	withStdio(t, "\ny\n\n\nn\n", func() { err = ModifyAdmin(user.Email, st) })
+	if err != nil {
+		t.Fatalf("ModifyAdmin: %v", err)
+	}
+	modified, err := st.GetAdmin(user.ID)
+	if err != nil {
+		t.Fatalf("GetAdmin: %v", err)
+	}
+	got := NewAdminRecord(user, *modified)
+	want := AdminRecord{Email: user.Email, CheckinAccess: true, AnticheatAccess: true}
+	if got != want {
+		t.Errorf("admin = %+v, want %+v", got, want)
+	}
+	if !modified.UpdatedAt.After(admin.UpdatedAt) {
+		t.Errorf("UpdatedAt not bumped: %v", modified.UpdatedAt)
+	}
+}
+
+func TestAddAdminCancelled(t *testing.T) {
+	db, st := openTestDB(t)
+	user := addTestUser(t, db, "alice@example.com")
+
+	var err error
+	withStdio(t, "y\nq\n", func() { err = AddAdmin(user.Email, st) })
+	if !errors.Is(err, ui.ErrCancelled) {
+		t.Fatalf("got %v, want %v", err, ui.ErrCancelled)
+	}
+	if _, err := st.GetAdmin(user.ID); !errors.Is(err, store.ErrAdminNotFound) {
+		t.Errorf("cancelled add created an admin: %v", err)
+	}
+}
+
+func TestAdminMatrixTotals(t *testing.T) {
+	db, st := openTestDB(t)
+	for i, email := range []string{"alice@example.com", "bob@example.com"} {
+		admin := store.NewAdmin(addTestUser(t, db, email))
+		admin.CheckinAccess = true
+		admin.CommunicationAccess = i == 0
+		if err := st.CreateAdmin(&admin); err != nil {
+			t.Fatalf("CreateAdmin: %v", err)
+		}
+	}
+
+	var err error
+	output := withStdio(t, "", func() { err = printAdminMatrix(st) })
+	if err != nil {
+		t.Fatalf("printAdminMatrix: %v", err)
+	}
+	for _, want := range []string{
+		"| alice@example.com | alice@example.com | ✓       | ✗         | ✗  | ✗             | ✓             |",
+		"| Total             | 2 admins          | 2       | 0         | 0  | 0             | 1             |",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("matrix has no line %q:\n%s", want, output)
+		}
+	}
+}
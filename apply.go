@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/qwerty-dvorak/gocli/mailaddr"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// State is the desired set of admins and flag values, kept in a yaml or
+// json file and synced to the database with "./main apply".
+type State struct {
+	Admins []AdminRecord   `json:"admins" yaml:"admins"`
+	Flags  map[string]bool `json:"flags" yaml:"flags"`
+}
+
+// stateChange is a single line of the diff between a State and the
+// database, together with the statement that makes it happen.
+type stateChange struct {
+	op      string
+	subject string
+	detail  string
+	apply   func(st store.Store) error
+}
+
+func ReadState(filename string) (*State, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// yaml is a superset of json, so one decoder handles both.
+	var state State
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file: %w", err)
+	}
+	for i := range state.Admins {
+		state.Admins[i].source = fmt.Sprintf("admin %d", i+1)
+	}
+	return &state, nil
+}
+
+// PlanState compares state with the database and returns the changes
+// needed to make the database match it. With prune, admins that are not
+// in state are deleted. Nothing is written.
+func PlanState(state *State, prune bool, st store.Store) ([]stateChange, error) {
+	var changes []stateChange
+	var errs []error
+
+	wanted := make(map[string]bool)
+	for _, record := range state.Admins {
+		email, err := mailaddr.Normalize(record.Email)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", record.source, err))
+			continue
+		}
+		record.Email = email
+		key := emailKey(email)
+		if wanted[key] {
+			errs = append(errs, fmt.Errorf("%s: duplicate email %s", record.source, record.Email))
+			continue
+		}
+		wanted[key] = true
+
+		user, err := findUser(email, st)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", record.source, record.Email, err))
+			continue
+		}
+		upsert := func(st store.Store) error {
+			_, err := upsertAdmin(*user, record, st)
+			return err
+		}
+		admin, err := st.GetAdmin(user.ID)
+		if errors.Is(err, store.ErrAdminNotFound) {
+			changes = append(changes, stateChange{"+", record.Email, describeAccess(record), upsert})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		current := NewAdminRecord(*user, *admin)
+		if detail := describeAccessChange(current, record); detail != "" {
+			changes = append(changes, stateChange{"~", record.Email, detail, upsert})
+		}
+	}
+
+	if prune {
+		existing, err := ListAdminRecords(st)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range existing {
+			if wanted[emailKey(record.Email)] {
+				continue
+			}
+			email := record.Email
+			changes = append(changes, stateChange{"-", email, "", func(st store.Store) error {
+				return DeleteAdmin(email, st)
+			}})
+		}
+	}
+
+	flags, err := st.ListFlags()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool)
+	for _, flag := range flags {
+		current[flag.Name] = flag.Value
+	}
+	names := make([]string, 0, len(state.Flags))
+	for name := range state.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := state.Flags[name]
+		old, ok := current[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("flag %s: %w", name, store.ErrFlagNotFound))
+			continue
+		}
+		if old == value {
+			continue
+		}
+		changes = append(changes, stateChange{"~", "flag " + name, fmt.Sprintf("%t -> %t", old, value), func(st store.Store) error {
+			return st.SetFlag(name, value)
+		}})
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return changes, nil
+}
+
+// ApplyState runs every change in a single transaction.
+func ApplyState(changes []stateChange, st store.Store) error {
+	return st.Tx(func(tx store.Store) error {
+		return applyChanges(changes, tx)
+	})
+}
+
+func applyChanges(changes []stateChange, st store.Store) error {
+	for _, change := range changes {
+		if err := change.apply(st); err != nil {
+			return fmt.Errorf("%s %s: %w", change.op, change.subject, err)
+		}
+	}
+	return nil
+}
+
+func describeAccess(record AdminRecord) string {
+	var granted []string
+	for i, access := range record.permissions() {
+		if access {
+			granted = append(granted, accessNames[i])
+		}
+	}
+	if len(granted) == 0 {
+		return "no access"
+	}
+	return strings.Join(granted, ", ")
+}
+
+func describeAccessChange(from, to AdminRecord) string {
+	var diffs []string
+	old := from.permissions()
+	for i, access := range to.permissions() {
+		if access != old[i] {
+			diffs = append(diffs, fmt.Sprintf("%s: %t -> %t", accessNames[i], old[i], access))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+func printStateChanges(changes []stateChange) {
+	if len(changes) == 0 {
+		console.Printf("%sNo changes, database matches the state file%s\n", green, reset)
+		return
+	}
+	colors := map[string]string{"+": green, "~": yellow, "-": red}
+	for _, change := range changes {
+		console.Printf("%s%s %s%s", colors[change.op], change.op, change.subject, reset)
+		if change.detail != "" {
+			console.Printf(" (%s)", change.detail)
+		}
+		console.Println()
+	}
+}
+
+func runApply(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	prune := fs.Bool("prune", false, "delete admins that are not in the file")
+	dryRun := fs.Bool("dry-run", false, "print the diff without applying it")
+	files := parseArgs(fs, args)
+	if len(files) != 1 {
+		fail("", usageError{"apply needs exactly one state file"})
+	}
+
+	state, err := ReadState(files[0])
+	if err != nil {
+		fail("reading state", err)
+	}
+	st := connect()
+	changes, err := PlanState(state, *prune, st)
+	if err != nil {
+		fail("planning changes", err)
+	}
+	printStateChanges(changes)
+	if len(changes) == 0 || *dryRun {
+		return
+	}
+	if err := ApplyState(changes, st); err != nil {
+		fail("applying changes", err)
+	}
+	console.Printf("%sApplied %d changes%s\n", green, len(changes), reset)
+}
@@ -2,23 +2,58 @@ package basic
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
-func NewSession() (*sql.DB, error) {
+// sqliteScheme marks a DATABASE_URL as a SQLite file, e.g.
+// sqlite://gocli.db or sqlite:///var/lib/gocli.db.
+const sqliteScheme = "sqlite://"
+
+// Open opens a database URL and returns it with the name of the
+// database/sql driver used: "sqlite3" for sqlite:// URLs and "postgres"
+// otherwise.
+func Open(databaseURL string) (*sql.DB, string, error) {
+	if path, ok := strings.CutPrefix(databaseURL, sqliteScheme); ok {
+		if path == "" {
+			return nil, "", fmt.Errorf("no file in %s", databaseURL)
+		}
+		db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+		return db, "sqlite3", err
+	}
+	db, err := sql.Open("postgres", databaseURL)
+	return db, "postgres", err
+}
+
+// NewSession opens the database at DATABASE_URL, read from the
+// environment or the .env file.
+func NewSession() (*sql.DB, string, error) {
+	return NewNamedSession("default")
+}
+
+// NewNamedSession opens the database configured for an environment such as
+// "staging" or "prod". The URL is read from DATABASE_URL_<NAME> in the
+// environment or the .env file; "default" uses DATABASE_URL.
+func NewNamedSession(name string) (*sql.DB, string, error) {
 	parentDir := filepath.Dir("..")
-	err := godotenv.Load(filepath.Join(parentDir, ".env"))
-	if err != nil {
-		log.Fatalf("Error loading .env file from parent directory: %v", err)
+	// A missing .env is fine as long as the variable is set some other way.
+	if err := godotenv.Load(filepath.Join(parentDir, ".env")); err != nil {
+		slog.Debug("not loading .env", "error", err)
+	}
+	key := "DATABASE_URL"
+	if name != "default" {
+		key += "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
 	}
-	databaseURL := os.Getenv("DATABASE_URL")
+	databaseURL := os.Getenv(key)
 	if databaseURL == "" {
-		log.Fatalf("DATABASE_URL not set in .env file")
+		return nil, "", fmt.Errorf("%s not set in environment or .env file", key)
 	}
-	return sql.Open("postgres", databaseURL)
+	return Open(databaseURL)
 }
@@ -0,0 +1,100 @@
+// Package cli holds the registry of prompt commands. Commands are grouped
+// in contexts ("admin", "flag", "whitelist", ...) and everything the
+// prompt needs, from help text to argument checks, tab completion and
+// one-shot dispatch from the command line, is derived from it.
+//
+// New commands are added from any package with an init function:
+//
+//	func init() {
+//		cli.Register("admin", myCommand{})
+//	}
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// Command is a single prompt command.
+type Command interface {
+	// Name is the word that invokes the command, e.g. "add".
+	Name() string
+	// Args describes the arguments, each written <required> or
+	// [optional], e.g. "<email> [file]". The last one may end in "..."
+	// to accept any number of values. It is used for help and to check
+	// the number of arguments before Run is called.
+	Args() string
+	// Help is a short lower case description that completes the
+	// sentence "Type 'add <email>' to ...".
+	Help() string
+	Run(st store.Store, args []string) error
+}
+
+// Completer is implemented by commands that can complete their arguments.
+// line is the whole line typed so far.
+type Completer interface {
+	Complete(st store.Store, line string) []string
+}
+
+// Func is a Command built from a usage line and functions.
+type Func struct {
+	// Use is the name followed by the args spec, e.g. "add <email>".
+	Use          string
+	Short        string
+	RunFunc      func(st store.Store, args []string) error
+	CompleteFunc func(st store.Store, line string) []string
+}
+
+func (f *Func) Name() string {
+	name, _, _ := strings.Cut(f.Use, " ")
+	return name
+}
+
+func (f *Func) Args() string {
+	_, args, _ := strings.Cut(f.Use, " ")
+	return strings.TrimSpace(args)
+}
+
+func (f *Func) Help() string {
+	return f.Short
+}
+
+func (f *Func) Run(st store.Store, args []string) error {
+	return f.RunFunc(st, args)
+}
+
+func (f *Func) Complete(st store.Store, line string) []string {
+	if f.CompleteFunc == nil {
+		return nil
+	}
+	return f.CompleteFunc(st, line)
+}
+
+// Usage returns the name and args spec of cmd, e.g. "add <email>".
+func Usage(cmd Command) string {
+	if cmd.Args() == "" {
+		return cmd.Name()
+	}
+	return cmd.Name() + " " + cmd.Args()
+}
+
+// CheckArgs validates the number of arguments against the args spec of
+// cmd.
+func CheckArgs(cmd Command, args []string) error {
+	spec := strings.Fields(cmd.Args())
+	required := 0
+	for _, arg := range spec {
+		if strings.HasPrefix(arg, "<") {
+			required++
+		}
+	}
+	if len(args) < required {
+		return fmt.Errorf("missing %s for %s command", strings.Trim(strings.TrimSuffix(spec[len(args)], "..."), "<>"), cmd.Name())
+	}
+	if len(args) > len(spec) && !strings.HasSuffix(cmd.Args(), "...") {
+		return fmt.Errorf("too many arguments for %s command, usage: %s", cmd.Name(), Usage(cmd))
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package cli
+
+import "testing"
+
+func TestCheckArgs(t *testing.T) {
+	cmd := &Func{Use: "describe <flag> <owner> <description>..."}
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"x"}, "missing owner for describe command"},
+		{[]string{"x", "ops"}, "missing description for describe command"},
+		{[]string{"x", "ops", "opens", "check-in"}, ""},
+	} {
+		err := CheckArgs(cmd, test.args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("CheckArgs(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
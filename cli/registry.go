@@ -0,0 +1,77 @@
+package cli
+
+import "fmt"
+
+// Registry maps context names to their commands, keeping the order in
+// which they were registered.
+type Registry struct {
+	contexts []string
+	commands map[string][]Command
+}
+
+func NewRegistry() *Registry {
+	return &Registry{commands: make(map[string][]Command)}
+}
+
+// Register adds cmd to context, creating the context on first use. It
+// panics if the context already has a command with the same name.
+func (r *Registry) Register(context string, cmd Command) {
+	if r.Lookup(context, cmd.Name()) != nil {
+		panic(fmt.Sprintf("cli: command %s %s registered twice", context, cmd.Name()))
+	}
+	if _, ok := r.commands[context]; !ok {
+		r.contexts = append(r.contexts, context)
+	}
+	r.commands[context] = append(r.commands[context], cmd)
+}
+
+// Contexts returns the context names in registration order.
+func (r *Registry) Contexts() []string {
+	return r.contexts
+}
+
+func (r *Registry) HasContext(context string) bool {
+	_, ok := r.commands[context]
+	return ok
+}
+
+// Commands returns the commands of context in registration order.
+func (r *Registry) Commands(context string) []Command {
+	return r.commands[context]
+}
+
+func (r *Registry) Lookup(context, name string) Command {
+	for _, cmd := range r.commands[context] {
+		if cmd.Name() == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// Resolve finds the command for words typed in context. The first word
+// is a command of context, or the name of another context followed by
+// one of its commands, as in "flag set x". It returns the context the
+// command belongs to and its arguments; cmd is nil if nothing matches.
+func (r *Registry) Resolve(context string, words []string) (string, Command, []string) {
+	if len(words) == 0 {
+		return context, nil, nil
+	}
+	if cmd := r.Lookup(context, words[0]); cmd != nil {
+		return context, cmd, words[1:]
+	}
+	if r.HasContext(words[0]) && len(words) > 1 {
+		if cmd := r.Lookup(words[0], words[1]); cmd != nil {
+			return words[0], cmd, words[2:]
+		}
+	}
+	return context, nil, nil
+}
+
+// Default is the registry used by the gocli binary.
+var Default = NewRegistry()
+
+// Register adds cmd to context in the Default registry.
+func Register(context string, cmd Command) {
+	Default.Register(context, cmd)
+}
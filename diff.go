@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/qwerty-dvorak/gocli/basic"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// AdminDiff is an admin whose permissions differ between two databases.
+// From or To is nil when the admin only exists on the other side.
+type AdminDiff struct {
+	Email string       `json:"email"`
+	From  *AdminRecord `json:"from"`
+	To    *AdminRecord `json:"to"`
+}
+
+// FlagDiff is a flag whose value differs between two databases. From or
+// To is nil when the flag only exists on the other side.
+type FlagDiff struct {
+	Name string `json:"name"`
+	From *bool  `json:"from"`
+	To   *bool  `json:"to"`
+}
+
+type DatabaseDiff struct {
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Admins []AdminDiff `json:"admins"`
+	Flags  []FlagDiff  `json:"flags"`
+}
+
+func (d *DatabaseDiff) Empty() bool {
+	return len(d.Admins) == 0 && len(d.Flags) == 0
+}
+
+// DiffDatabases compares admin permissions by email and flag values by
+// name between two databases.
+func DiffDatabases(from, to store.Store) (*DatabaseDiff, error) {
+	diff := &DatabaseDiff{Admins: []AdminDiff{}, Flags: []FlagDiff{}}
+
+	fromAdmins, err := adminsByEmail(from)
+	if err != nil {
+		return nil, err
+	}
+	toAdmins, err := adminsByEmail(to)
+	if err != nil {
+		return nil, err
+	}
+	for _, email := range unionKeys(fromAdmins, toAdmins) {
+		a, b := fromAdmins[email], toAdmins[email]
+		if a != nil && b != nil && describeAccessChange(*a, *b) == "" {
+			continue
+		}
+		diff.Admins = append(diff.Admins, AdminDiff{Email: email, From: a, To: b})
+	}
+
+	fromFlags, err := flagsByName(from)
+	if err != nil {
+		return nil, err
+	}
+	toFlags, err := flagsByName(to)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range unionKeys(fromFlags, toFlags) {
+		a, b := fromFlags[name], toFlags[name]
+		if a != nil && b != nil && *a == *b {
+			continue
+		}
+		diff.Flags = append(diff.Flags, FlagDiff{Name: name, From: a, To: b})
+	}
+	return diff, nil
+}
+
+func adminsByEmail(st store.Store) (map[string]*AdminRecord, error) {
+	records, err := ListAdminRecords(st)
+	if err != nil {
+		return nil, err
+	}
+	admins := make(map[string]*AdminRecord, len(records))
+	for i := range records {
+		admins[emailKey(records[i].Email)] = &records[i]
+	}
+	return admins, nil
+}
+
+func flagsByName(st store.Store) (map[string]*bool, error) {
+	flags, err := st.ListFlags()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]*bool, len(flags))
+	for i := range flags {
+		values[flags[i].Name] = &flags[i].Value
+	}
+	return values, nil
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	var keys []string
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func printDatabaseDiff(diff *DatabaseDiff) {
+	if diff.Empty() {
+		console.Printf("%sNo differences between %s and %s%s\n", green, diff.From, diff.To, reset)
+		return
+	}
+
+	table := newTable("Item", diff.From, diff.To)
+	for _, admin := range diff.Admins {
+		table.AddRow(diffColor(admin.From != nil, admin.To != nil),
+			"admin "+admin.Email, describeAdminSide(admin.From), describeAdminSide(admin.To))
+	}
+	for _, flag := range diff.Flags {
+		table.AddRow(diffColor(flag.From != nil, flag.To != nil),
+			"flag "+flag.Name, describeFlagSide(flag.From), describeFlagSide(flag.To))
+	}
+
+	console.Printf("%sDifferences between %s and %s:%s\n", cyan, diff.From, diff.To, reset)
+	console.PrintTable(table)
+}
+
+// diffColor is red for items that would be removed going from one side
+// to the other, green for items that would be added and yellow otherwise.
+func diffColor(inFrom, inTo bool) string {
+	if !inTo {
+		return red
+	}
+	if !inFrom {
+		return green
+	}
+	return yellow
+}
+
+func describeAdminSide(record *AdminRecord) string {
+	if record == nil {
+		return "-"
+	}
+	return describeAccess(*record)
+}
+
+func describeFlagSide(value *bool) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%t", *value)
+}
+
+// runDiff compares two configured databases and exits with status 1 when
+// they differ, like diff(1).
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	from := fs.String("from", "", "environment to compare from, e.g. staging")
+	to := fs.String("to", "", "environment to compare to, e.g. prod")
+	format := fs.String("format", "table", "output format: table or json")
+	if rest := parseArgs(fs, args); len(rest) > 0 || *from == "" || *to == "" {
+		fail("", usageError{"diff needs --from and --to"})
+	}
+	if *format != "table" && *format != "json" {
+		fail("", usageError{"unknown format " + *format})
+	}
+
+	fromDB, fromStore := connectNamed(*from)
+	defer fromDB.Close()
+	toDB, toStore := connectNamed(*to)
+	defer toDB.Close()
+
+	diff, err := DiffDatabases(fromStore, toStore)
+	if err != nil {
+		fail("comparing databases", err)
+	}
+	diff.From, diff.To = *from, *to
+
+	if *format == "json" {
+		encoder := json.NewEncoder(console.Out)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(diff)
+	} else {
+		printDatabaseDiff(diff)
+	}
+	if !diff.Empty() {
+		fromDB.Close()
+		toDB.Close()
+		os.Exit(1)
+	}
+}
+
+func connectNamed(name string) (*sql.DB, store.Store) {
+	db, driver, err := basic.NewNamedSession(name)
+	if err == nil {
+		var st store.Store
+		if st, err = store.Open(db, driver); err == nil {
+			return db, st
+		}
+	}
+	fail("connecting to "+name, connectionError(err))
+	return nil, nil
+}
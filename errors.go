@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/qwerty-dvorak/gocli/store"
+	"github.com/qwerty-dvorak/gocli/ui"
+)
+
+var verbose = flag.Bool("verbose", false, "show the underlying database errors")
+
+// opError is the failure of an operation on a subject, such as adding the
+// admin with an email. Its message explains store errors in terms of the
+// subject; the raw driver error is only shown with --verbose.
+type opError struct {
+	op      string
+	subject string
+	err     error
+	// suggestions are what the subject may have been meant to be.
+	suggestions []string
+}
+
+// userOpError is the opError of an operation on the user with email,
+// suggesting similar emails when there is no such user.
+func userOpError(op, email string, err error, st store.Store) error {
+	opErr := &opError{op: op, subject: email, err: err}
+	if errors.Is(err, store.ErrUserNotFound) {
+		opErr.suggestions = suggestEmails(email, st)
+	}
+	return opErr
+}
+
+func (e *opError) Error() string {
+	msg := explain(e.err, e.subject)
+	switch {
+	case msg == "":
+		msg = fmt.Sprintf("%s %s: %v", e.op, e.subject, e.err)
+	case *verbose:
+		msg = fmt.Sprintf("%s: %s (%v)", e.op, msg, e.err)
+	default:
+		msg = e.op + ": " + msg
+	}
+	if len(e.suggestions) > 0 {
+		msg += fmt.Sprintf(". Did you mean %s?", strings.Join(e.suggestions, " or "))
+	}
+	return msg
+}
+
+func (e *opError) Unwrap() error {
+	return e.err
+}
+
+// explain describes a store error about subject, an email or a flag
+// name, saying what to do about it. It returns "" for other errors.
+func explain(err error, subject string) string {
+	switch store.ErrorCode(err) {
+	case store.CodeUserNotFound:
+		return fmt.Sprintf("no user has the email %s; they need to register first", subject)
+	case store.CodeAdminNotFound:
+		return fmt.Sprintf("%s is not an admin", subject)
+	case store.CodeAdminExists:
+		return fmt.Sprintf("%s is already an admin; use modify to change their access", subject)
+	case store.CodeFlagNotFound:
+		return fmt.Sprintf("there is no flag named %s; use see to list them", subject)
+	case store.CodeDuplicate:
+		return fmt.Sprintf("%s already exists", subject)
+	case store.CodeReference:
+		return fmt.Sprintf("%s refers to a user or admin that no longer exists", subject)
+	case store.CodeMissingValue:
+		return fmt.Sprintf("a required value is missing for %s", subject)
+	case store.CodeConstraint:
+		return fmt.Sprintf("the database rejected %s", subject)
+	case store.CodeConnection:
+		return "could not reach the database; check DATABASE_URL and that the server is up"
+	case store.CodeSchemaOutdated:
+		return "the database is missing columns gocli needs; run ./main migrate first"
+	}
+	return ""
+}
+
+// usageError is a command line that could not be run at all, as opposed
+// to a command that failed.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// storeExitCodes maps store error codes to sysexits(3) statuses.
+var storeExitCodes = map[store.Code]int{
+	store.CodeUserNotFound:   67, // EX_NOUSER
+	store.CodeAdminNotFound:  65, // EX_DATAERR
+	store.CodeAdminExists:    65,
+	store.CodeFlagNotFound:   65,
+	store.CodeConstraint:     65,
+	store.CodeScan:           74, // EX_IOERR
+	store.CodeUnknown:        74,
+	store.CodeDuplicate:      65,
+	store.CodeReference:      65,
+	store.CodeMissingValue:   65,
+	store.CodeConnection:     69, // EX_UNAVAILABLE
+	store.CodeSchemaOutdated: 78, // EX_CONFIG
+}
+
+// exitCode returns the status gocli exits with after err. Missing input
+// files and failures to read or write files have statuses of their own;
+// other errors that do not come from the store, such as invalid import
+// files, are data errors.
+func exitCode(err error) int {
+	var storeErr *store.Error
+	var pathErr *fs.PathError
+	switch {
+	case err == nil, errors.Is(err, ui.ErrCancelled):
+		return 0
+	case errors.As(err, &usageError{}):
+		return 64
+	case errors.As(err, &storeErr):
+		return storeExitCodes[storeErr.Code]
+	case errors.Is(err, fs.ErrNotExist):
+		return 66 // EX_NOINPUT
+	case errors.As(err, &pathErr):
+		return 74
+	}
+	return 65
+}
+
+// fail prints a top-level error, after the usage for a usage error, and
+// exits with the status exitCode gives it.
+func fail(op string, err error) {
+	if op == "" {
+		console.Printf("%sError: %v%s\n", red, err, reset)
+	} else {
+		console.Printf("%sError %s: %v%s\n", red, op, err, reset)
+	}
+	if errors.As(err, &usageError{}) {
+		printCommandUsage()
+	}
+	os.Exit(exitCode(err))
+}
+
+// connectionError classifies a failure to open a database as a
+// connection error, unless the store already gave it a code.
+func connectionError(err error) error {
+	if store.ErrorCode(err) != store.CodeUnknown {
+		return err
+	}
+	return &store.Error{Code: store.CodeConnection, Err: err}
+}
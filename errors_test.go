@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/qwerty-dvorak/gocli/store"
+	"github.com/qwerty-dvorak/gocli/ui"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{fmt.Errorf("adding admin: %w", ui.ErrCancelled), 0},
+		{usageError{"unknown command x"}, 64},
+		{fmt.Errorf("adding admin: %w", store.ErrUserNotFound), 67},
+		{fmt.Errorf("setting flag: %w", store.ErrFlagNotFound), 65},
+		{&store.Error{Code: store.CodeScan, Err: sql.ErrConnDone}, 74},
+		{errors.New("invalid access value"), 65},
+		{connectionError(errors.New("DATABASE_URL not set")), 69},
+		{errors.Join(fmt.Errorf("flag x: %w", store.ErrFlagNotFound)), 65},
+		{fmt.Errorf("reading state: %w", &fs.PathError{Op: "open", Path: "state.yaml", Err: fs.ErrNotExist}), 66},
+		{&fs.PathError{Op: "write", Path: "snapshot.json", Err: errors.New("no space left on device")}, 74},
+	} {
+		if got := exitCode(test.err); got != test.want {
+			t.Errorf("exitCode(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestStoreErrorWrapsCause(t *testing.T) {
+	err := fmt.Errorf("adding admin: %w", &store.Error{Code: store.CodeScan, Err: sql.ErrConnDone})
+	if !errors.Is(err, store.ErrScanRow) || !errors.Is(err, sql.ErrConnDone) {
+		t.Errorf("%v does not match both its code and its cause", err)
+	}
+	if errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("%v matches another code", err)
+	}
+}
+
+func TestConstraintViolationsAreExplained(t *testing.T) {
+	db, st := openTestDB(t)
+	alice := addTestUser(t, db, "alice@example.com")
+	bob := addTestUser(t, db, "bob@example.com")
+
+	admin := store.NewAdmin(alice)
+	if err := st.CreateAdmin(&admin); err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	duplicate := store.NewAdmin(bob)
+	duplicate.ID = admin.ID
+	missing := store.NewAdmin(store.User{Base: store.NewBase(), Email: "ghost@example.com"})
+
+	for _, test := range []struct {
+		admin store.Admin
+		code  store.Code
+		want  string
+	}{
+		{duplicate, store.CodeDuplicate, "adding admin: bob@example.com already exists"},
+		{missing, store.CodeReference, "adding admin: ghost@example.com refers to a user or admin that no longer exists"},
+	} {
+		err := st.CreateAdmin(&test.admin)
+		if !errors.Is(err, store.ErrConstraint) || store.ErrorCode(err) != test.code {
+			t.Errorf("creating admin %s: got %v, want code %d", test.admin.User.Email, err, test.code)
+			continue
+		}
+		opErr := &opError{op: "adding admin", subject: test.admin.User.Email, err: err}
+		if got := opErr.Error(); got != test.want {
+			t.Errorf("message = %q, want %q", got, test.want)
+		}
+
+		// --verbose adds the driver error, such as "UNIQUE constraint
+		// failed: admins.id", after the explanation.
+		*verbose = true
+		got := opErr.Error()
+		*verbose = false
+		cause := errors.Unwrap(err)
+		if cause == nil || cause.Error() == "" {
+			t.Fatalf("%v has no driver error", err)
+		}
+		if want := test.want + " (" + err.Error() + ")"; got != want || !strings.Contains(got, cause.Error()) {
+			t.Errorf("verbose message = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwerty-dvorak/gocli/basic"
+	"github.com/qwerty-dvorak/gocli/cli"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+func TestSetAndResetFlag(t *testing.T) {
+	db, st := openTestDB(t)
+	addTestFlag(t, db, "registration", false)
+
+	for _, test := range []struct {
+		command string
+		want    bool
+	}{
+		{"set", true},
+		{"reset", false},
+	} {
+		var err error
+		withStdio(t, "", func() { err = cli.Default.Lookup("flag", test.command).Run(st, []string{"registration"}) })
+		if err != nil {
+			t.Fatalf("flag %s: %v", test.command, err)
+		}
+		flags, err := st.ListFlags()
+		if err != nil {
+			t.Fatalf("ListFlags: %v", err)
+		}
+		if len(flags) != 1 || flags[0].Value != test.want {
+			t.Errorf("after flag %s: flags = %+v, want registration=%t", test.command, flags, test.want)
+		}
+	}
+}
+
+func TestSetUnknownFlag(t *testing.T) {
+	_, st := openTestDB(t)
+	for _, command := range []string{"set", "reset"} {
+		var err error
+		withStdio(t, "", func() { err = cli.Default.Lookup("flag", command).Run(st, []string{"nope"}) })
+		if !errors.Is(err, store.ErrFlagNotFound) {
+			t.Errorf("flag %s nope: got %v, want %v", command, err, store.ErrFlagNotFound)
+		}
+	}
+}
+
+func TestSetFlagGroup(t *testing.T) {
+	db, st := openTestDB(t)
+	addTestFlag(t, db, "checkin.open", false)
+	addTestFlag(t, db, "checkin.late.allowed", false)
+	addTestFlag(t, db, "checkout.open", false)
+
+	var err error
+	output := withStdio(t, "", func() { err = registeredCommand(t, "flag", "set").Run(st, []string{"checkin.*"}) })
+	if err != nil {
+		t.Fatalf("flag set checkin.*: %v", err)
+	}
+	if !strings.Contains(output, "2 flags set") {
+		t.Errorf("output = %q, want 2 flags set", output)
+	}
+	flags, err := st.ListFlags()
+	if err != nil {
+		t.Fatalf("ListFlags: %v", err)
+	}
+	for _, flag := range flags {
+		if want := flag.Name != "checkout.open"; flag.Value != want {
+			t.Errorf("%s = %t, want %t", flag.Name, flag.Value, want)
+		}
+	}
+
+	withStdio(t, "", func() { err = registeredCommand(t, "flag", "set").Run(st, []string{"nope.*"}) })
+	if !errors.Is(err, store.ErrFlagNotFound) {
+		t.Errorf("flag set nope.*: got %v, want %v", err, store.ErrFlagNotFound)
+	}
+}
+
+func TestDescribeAndSeeFlagGroup(t *testing.T) {
+	db, st := openTestDB(t)
+	addTestFlag(t, db, "checkin.open", true)
+	addTestFlag(t, db, "registration", false)
+
+	var err error
+	withStdio(t, "", func() {
+		err = registeredCommand(t, "flag", "describe").Run(st, []string{"checkin.open", "ops", "Lets", "people", "check", "in"})
+	})
+	if err != nil {
+		t.Fatalf("flag describe: %v", err)
+	}
+	output := withStdio(t, "", func() { err = registeredCommand(t, "flag", "see").Run(st, []string{"checkin"}) })
+	if err != nil {
+		t.Fatalf("flag see checkin: %v", err)
+	}
+	if !strings.Contains(output, "| checkin.open | true  | checkin | ops   | Lets people check in |") {
+		t.Errorf("flag see checkin does not describe checkin.open:\n%s", output)
+	}
+	if strings.Contains(output, "registration") {
+		t.Errorf("flag see checkin lists a flag outside the group:\n%s", output)
+	}
+}
+
+// A flags table made before flags had metadata can still be listed and
+// set, and gains the new columns once migrated.
+func TestMigrateAddsFlagColumns(t *testing.T) {
+	db, _, err := basic.Open("sqlite://" + filepath.Join(t.TempDir(), "old.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE flags (name TEXT PRIMARY KEY, value BOOLEAN NOT NULL DEFAULT FALSE);
+		INSERT INTO flags (name, value) VALUES ('registration', FALSE)`); err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Open(db, store.DriverSQLite)
+	if err != nil {
+		t.Fatalf("opening an old database: %v", err)
+	}
+	if err := st.SetFlag("registration", true); err != nil {
+		t.Fatalf("SetFlag before migrating: %v", err)
+	}
+	if flags, err := st.ListFlags(); err != nil || len(flags) != 1 || !flags[0].Value {
+		t.Fatalf("ListFlags before migrating = %+v, %v; want registration set", flags, err)
+	}
+	if err := st.DescribeFlag("registration", "ops", "Opens sign-ups"); store.ErrorCode(err) != store.CodeSchemaOutdated {
+		t.Fatalf("DescribeFlag before migrating: got %v, want an outdated schema", err)
+	}
+
+	changes, err := store.Migrate(db, store.DriverSQLite)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(changes) != 4 {
+		t.Errorf("Migrate made %q, want the four metadata columns added", changes)
+	}
+	if changes, err := store.Migrate(db, store.DriverSQLite); err != nil || len(changes) != 0 {
+		t.Errorf("migrating again made %q, %v; want nothing", changes, err)
+	}
+	st, err = store.Open(db, store.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DescribeFlag("registration", "ops", "Opens sign-ups"); err != nil {
+		t.Fatalf("DescribeFlag: %v", err)
+	}
+	flags, err := st.ListFlags()
+	if err != nil {
+		t.Fatalf("ListFlags: %v", err)
+	}
+	if len(flags) != 1 || !flags[0].Value || flags[0].Owner != "ops" || !flags[0].CreatedAt.IsZero() || flags[0].UpdatedAt.IsZero() {
+		t.Errorf("flags = %+v, want registration owned by ops, updated but of unknown age", flags)
+	}
+}
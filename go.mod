@@ -3,7 +3,18 @@ module github.com/qwerty-dvorak/gocli
 go 1.22.5
 
 require (
+	github.com/chzyer/readline v1.5.1
+	github.com/fergusstrange/embedded-postgres v1.34.0
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
+	github.com/mattn/go-runewidth v0.0.16
+	github.com/mattn/go-sqlite3 v1.14.33
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/rivo/uniseg v0.2.0 // indirect
+	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
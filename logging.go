@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+)
+
+var (
+	logInfo  = flag.Bool("v", false, "log what gocli does to stderr")
+	logDebug = flag.Bool("vv", false, "like -v, and trace every SQL query with its arguments and duration")
+	logFile  = flag.String("log-file", "", "append JSON logs to this file")
+)
+
+// setupLogging installs the default slog logger. Logs go to stderr, apart
+// from the output on stdout: warnings only, everything with -v and SQL
+// tracing too with -vv. --log-file also writes them as JSON, at least at
+// info level so batch runs leave a trail.
+func setupLogging() error {
+	level := slog.LevelWarn
+	if *logInfo {
+		level = slog.LevelInfo
+	}
+	if *logDebug {
+		level = slog.LevelDebug
+	}
+	handlers := teeHandler{slog.NewTextHandler(console.Err, &slog.HandlerOptions{Level: level})}
+
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		handlers = append(handlers, slog.NewJSONHandler(file, &slog.HandlerOptions{Level: min(level, slog.LevelInfo)}))
+	}
+	slog.SetDefault(slog.New(handlers))
+	return nil
+}
+
+// teeHandler sends each record to every handler that accepts its level.
+type teeHandler []slog.Handler
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	tee := make(teeHandler, len(h))
+	for i, handler := range h {
+		tee[i] = handler.WithAttrs(attrs)
+	}
+	return tee
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	tee := make(teeHandler, len(h))
+	for i, handler := range h {
+		tee[i] = handler.WithGroup(name)
+	}
+	return tee
+}
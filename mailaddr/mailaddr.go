@@ -0,0 +1,44 @@
+// Package mailaddr normalizes and validates the email addresses gocli
+// looks people up by, so that " Adheesh@Gmail.com" and
+// "adheesh@gmail.com" are the same person.
+package mailaddr
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Normalize trims and lowercases address and checks that it is a bare
+// RFC 5322 addr-spec, such as "name@example.com" without a display name.
+func Normalize(address string) (string, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if address == "" {
+		return "", errors.New("missing email")
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return "", fmt.Errorf("invalid email %q", address)
+	}
+	local, domain, _ := strings.Cut(address, "@")
+	if local == "" || domain == "" {
+		return "", fmt.Errorf("invalid email %q", address)
+	}
+	return address, nil
+}
+
+// gmailDomains are the domains whose local parts ignore dots and +tags.
+var gmailDomains = map[string]bool{"gmail.com": true, "googlemail.com": true}
+
+// FoldGmail returns the address Gmail delivers a normalized address to:
+// "a.b+event@googlemail.com" becomes "ab@gmail.com". Other addresses are
+// returned unchanged.
+func FoldGmail(address string) string {
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || !gmailDomains[domain] {
+		return address
+	}
+	local, _, _ = strings.Cut(local, "+")
+	return strings.ReplaceAll(local, ".", "") + "@gmail.com"
+}
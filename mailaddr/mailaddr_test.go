@@ -0,0 +1,43 @@
+package mailaddr
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for _, test := range []struct {
+		address, want string
+	}{
+		{" Alice@Example.COM ", "alice@example.com"},
+		{"first.last+tag@example.co.uk", "first.last+tag@example.co.uk"},
+		{"", ""},
+		{"alice", ""},
+		{"alice@", ""},
+		{"@example.com", ""},
+		{"Alice <alice@example.com>", ""},
+		{"alice@example.com, bob@example.com", ""},
+		{"alice smith@example.com", ""},
+	} {
+		got, err := Normalize(test.address)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("Normalize(%q) = %q, want an error", test.address, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", test.address, got, err, test.want)
+		}
+	}
+}
+
+func TestFoldGmail(t *testing.T) {
+	for address, want := range map[string]string{
+		"a.b+event@gmail.com":   "ab@gmail.com",
+		"a.b@googlemail.com":    "ab@gmail.com",
+		"a.b+event@example.com": "a.b+event@example.com",
+		"not an address":        "not an address",
+	} {
+		if got := FoldGmail(address); got != want {
+			t.Errorf("FoldGmail(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
@@ -2,789 +2,569 @@ package main
 
 import (
 	"bufio"
-	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/chzyer/readline"
 	_ "github.com/lib/pq"
 
 	"github.com/qwerty-dvorak/gocli/basic"
+	"github.com/qwerty-dvorak/gocli/cli"
+	"github.com/qwerty-dvorak/gocli/mailaddr"
+	"github.com/qwerty-dvorak/gocli/store"
+	"github.com/qwerty-dvorak/gocli/ui"
 )
 
-var ErrUserNotFound = errors.New("user not found")
-var ErrScanRow = errors.New("error scanning row")
-
-const (
-	reset  = "\033[0m"
-	red    = "\033[31m"
-	green  = "\033[32m"
-	yellow = "\033[33m"
-	blue   = "\033[34m"
-	magenta = "\033[35m"
-	cyan   = "\033[36m"
-	bold   = "\033[1m"
-)
+// The styles of console.Theme, set by setupConsole. They are empty when
+// the output is not colored.
+var reset, red, green, yellow, blue, magenta, cyan, bold string
 
-type Base struct {
-	ID        string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-}
+var colorMode = flag.String("color", "auto", "color output: auto, always or never")
 
-func NewBase() Base {
-	return Base{
-		ID:        uuid.New().String(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+// setupConsole picks the themes of stdout and stderr for --color, makes
+// the styles above follow the one of stdout and fits tables to the
+// terminal.
+func setupConsole() error {
+	if readline.IsTerminal(int(os.Stdout.Fd())) {
+		console.Width = readline.GetScreenWidth()
 	}
+	mode, err := ui.ParseColorMode(*colorMode)
+	if err != nil {
+		return err
+	}
+	console.Theme = ui.ThemeFor(mode, console.Out)
+	console.ErrTheme = ui.ThemeFor(mode, console.Err)
+	theme := console.Theme
+	reset, bold = theme.Reset, theme.Bold
+	red, green, yellow, blue, magenta, cyan = theme.Red, theme.Green, theme.Yellow, theme.Blue, theme.Magenta, theme.Cyan
+	return nil
 }
 
-type User struct {
-	Base
-	Email string
-	Name  string
-}
-
-type Admin struct {
-	Base
-	CheckinAccess            bool
-	AnticheatAccess          bool
-	QrmgmtAccess             bool
-	QuestionManagementAccess bool
-	CommunicationAccess      bool
-	UserID                   string
-	User                     User
-}
-
-type Flag struct {
-	Base
-	Name	string
-	Value   bool
+func init() {
+	registerAdminCommands()
+	registerFlagCommands()
+	registerWhitelistCommands()
+	registerUserCommands()
 }
 
-var haderror bool
-
 func printCommandUsage() {
-	fmt.Printf("%sUsage (to run on text): ./main file <filename>%s\n", cyan, reset)
-	fmt.Printf("%sUsage (to run in admin prompt): ./main admin%s\n", cyan, reset)
-	fmt.Printf("%sUsage (to run in flag prompt): ./main flag%s\n", cyan, reset)
-	fmt.Printf("%sUsage (to run in whitelist prompt): ./main whitelist%s\n", cyan, reset)
-}
-
-func printAdminUsage() {
-	fmt.Printf("%sAvailable commands:%s\n", yellow, reset)
-	fmt.Printf("  Type %s'q'%s to exit\n", green, reset)
-	fmt.Printf("  Type %s'h'%s for help\n", green, reset)
-	fmt.Printf("  Type %s'add <email>'%s to add an admin\n", green, reset)
-	fmt.Printf("  Type %s'delete <email>'%s to delete an admin\n", green, reset)
-	fmt.Printf("  Type %s'modify <email>'%s to modify an admin\n", green, reset)
+	console.Printf("%sUsage (to run on text): ./main file <filename>%s\n", cyan, reset)
+	for _, ctx := range cli.Default.Contexts() {
+		console.Printf("%sUsage (to run in %s prompt): ./main %s%s\n", cyan, ctx, ctx, reset)
+	}
+	console.Printf("%sUsage (to run a single command): ./main %s <command> [args]%s\n", cyan, strings.Join(cli.Default.Contexts(), "|"), reset)
+	console.Printf("%sUsage (to sync admins and flags from yaml/json): ./main apply [--prune] [--dry-run] <file>%s\n", cyan, reset)
+	console.Printf("%sUsage (to compare two databases): ./main diff --from=<env> --to=<env> [--format=table|json]%s\n", cyan, reset)
+	console.Printf("%sUsage (to back up or restore admins, flags and whitelist): ./main snapshot save|restore <file>%s\n", cyan, reset)
+	console.Printf("%sUsage (to add the columns gocli needs to the database): ./main migrate%s\n", cyan, reset)
+	console.Printf("%sGlobal options (before the command): --backend=database|memory [--fixture=<file>] [--color=auto|always|never] [--verbose] [-v|-vv] [--log-file=<file>] [--fold-gmail]%s\n", cyan, reset)
 }
 
-func printFlagUsage(){
-	fmt.Printf("%sAvailable commands:%s\n", yellow, reset)
-	fmt.Printf("  Type %s'q'%s to exit\n", green, reset)
-	fmt.Printf("  Type %s'h'%s for help\n", green, reset)
-	fmt.Printf("  Type %s'see'%s to see all flags\n", green, reset)
-	fmt.Printf("  Type %s'set <flag>'%s to set flag to true\n", green, reset)
-	fmt.Printf("  Type %s'reset <flag>'%s to set flag to false\n", green, reset)
-}
+// console is where gocli prints and reads answers to prompts from.
+// Tests and programs embedding gocli replace it.
+var console = ui.New(os.Stdin, os.Stdout, os.Stderr)
 
-func printWhitelist(){
-	fmt.Printf("%sAvailable commands:%s\n", yellow, reset)
-	fmt.Printf("  Type %s'q'%s to exit\n", green, reset)
-	fmt.Printf("  Type %s'h'%s for help\n", green, reset)
-	fmt.Printf("  Type %s'add'%s to seed csv\n", green, reset)
-}
+// Global options, given before the command.
+var (
+	backend = flag.String("backend", "database", "data backend: database (DATABASE_URL) or memory")
+	fixture = flag.String("fixture", "", "yaml or json file to seed the memory backend with")
+)
 
 func main() {
-	args := os.Args
-	if len(args) > 3 {
-		fmt.Printf("%sError: Too many arguments provided%s\n", red, reset)
+	flag.Parse()
+	if err := setupConsole(); err != nil {
+		fail("", usageError{err.Error()})
+	}
+	if err := setupLogging(); err != nil {
+		fail("opening log file", err)
+	}
+	args := append(os.Args[:1:1], flag.Args()...)
+	if len(args) < 2 {
+		console.Printf("%sWrong argument%s\n", red, reset)
 		printCommandUsage()
-		os.Exit(64)
-	} else if len(args) ==3 {
-		db, err := basic.NewSession()
-		if err != nil {
-			fmt.Printf("%sCould not connect to database: %v%s\n", red, err, reset)
-			os.Exit(74)
-		}
-		fmt.Printf("%sConnected to database%s\n", magenta, reset)
-		runFile(args[2],db);
-	}else if len(args) == 2 {
-		if (args[1] =="admin"){
-			db, err := basic.NewSession()
-			if err != nil {
-				fmt.Printf("%sCould not connect to database: %v%s\n", red, err, reset)
-				os.Exit(74)
-			}
-			fmt.Printf("%sConnected to database%s\n", magenta, reset)
-			printAdminUsage()
-			runPrompt1(db)
-		} else if (args[1]=="flag"){
-			db, err := basic.NewSession()
-			if err != nil {
-				fmt.Printf("%sCould not connect to database: %v%s\n", red, err, reset)
-				os.Exit(74)
-			}
-			fmt.Printf("%sConnected to database%s\n", magenta, reset)
-			printFlagUsage()
-			runPrompt2(db)
-		} else if (args[1]=="whitelist"){
-			db, err := basic.NewSession()
-			if err != nil {
-				fmt.Printf("%sCould not connect to database: %v%s\n", red, err, reset)
-				os.Exit(74)
+		return
+	}
+	switch args[1] {
+	case "apply":
+		runApply(args[2:])
+	case "diff":
+		runDiff(args[2:])
+	case "snapshot":
+		runSnapshot(args[2:])
+	case "migrate":
+		runMigrate(args[2:])
+	default:
+		if cli.Default.HasContext(args[1]) {
+			st := connect()
+			if len(args) > 2 {
+				runCommand(args[1], args[2:], st)
+				return
 			}
-			fmt.Printf("%sConnected to database%s\n", magenta, reset)
-			printWhitelist()
-			runPrompt3(db)
-		} else {
-			fmt.Printf("%sWrong argument%s\n", red, reset)
+			runShell(args[1], st)
+			return
+		}
+		if len(args) > 3 {
+			fail("", usageError{"too many arguments provided"})
+		} else if len(args) != 3 {
+			console.Printf("%sWrong argument%s\n", red, reset)
 			printCommandUsage()
+			return
 		}
-	} else {
-		fmt.Printf("%sWrong argument%s\n", red, reset)
-		printCommandUsage()
+		st := connect()
+		runFile(args[2], st)
 	}
 }
 
-
-func runPrompt1(db *sql.DB) {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Printf("%s>%s ", blue, reset)
-		line, err := reader.ReadString('\n')
+// connect opens the backend chosen with --backend. The memory backend
+// starts empty unless seeded with --fixture, and is lost on exit.
+func connect() store.Store {
+	switch *backend {
+	case "database":
+	case "memory":
+		if *fixture == "" {
+			console.Errorf("%sUsing empty in-memory store%s\n", console.ErrTheme.Magenta, console.ErrTheme.Reset)
+			return store.NewMemory()
+		}
+		st, err := store.LoadFixture(*fixture)
 		if err != nil {
-			fmt.Println()
-			break
-		}
-		line = strings.TrimSpace(line)
-		if line == "exit" || line == "quit" || line == "q" {
-			break
-		}
-		if line == "h" || line == "help" {
-			printAdminUsage()
-			continue
-		}
-		run1(line, db)
-		if haderror {
-			haderror = false
+			fail("loading fixture "+*fixture, err)
 		}
+		console.Errorf("%sUsing in-memory store seeded from %s%s\n", console.ErrTheme.Magenta, *fixture, console.ErrTheme.Reset)
+		slog.Info("using memory store", "fixture", *fixture)
+		return st
+	default:
+		fail("", usageError{"unknown backend " + *backend})
 	}
-}
-
-func runPrompt2(db *sql.DB) {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Printf("%s>%s ", blue, reset)
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println()
-			break
-		}
-		line = strings.TrimSpace(line)
-		if line == "exit" || line == "quit" || line == "q" {
-			break
-		}
-		if line == "h" || line == "help" {
-			printFlagUsage()
-			continue
-		}
-		run2(line, db)
-		if haderror {
-			haderror = false
-		}
+	db, driver, err := basic.NewSession()
+	if err != nil {
+		fail("connecting to database", connectionError(err))
+	}
+	st, err := store.Open(db, driver)
+	if err != nil {
+		fail("connecting to database", connectionError(err))
 	}
+	console.Errorf("%sConnected to database%s\n", console.ErrTheme.Magenta, console.ErrTheme.Reset)
+	slog.Info("connected to database", "driver", driver)
+	return st
 }
 
-func runPrompt3(db *sql.DB) {
-	reader := bufio.NewReader(os.Stdin)
+// parseArgs parses flags that may appear before or after the positional
+// arguments and returns the positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
 	for {
-		fmt.Printf("%s>%s ", blue, reset)
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println()
-			break
-		}
-		line = strings.TrimSpace(line)
-		if line == "exit" || line == "quit" || line == "q" {
-			break
-		}
-		if line == "h" || line == "help" {
-			printWhitelist()
-			continue
-		}
-		run3(line, db)
-		if haderror {
-			haderror = false
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
 		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
 }
 
-func runFile(filename string, db *sql.DB) {
+func runFile(filename string, st store.Store) {
 	re := regexp.MustCompile(`^(.*?)(\.[^.]*$|$)`)
-    matches := re.FindStringSubmatch(filename)
-    if len(matches) < 3 {
-        fmt.Printf("%sInvalid filename format: %s%s\n", red, filename, reset)
-        os.Exit(64)
-    }
-    name := matches[1]
-    extension := matches[2]
+	matches := re.FindStringSubmatch(filename)
+	if len(matches) < 3 {
+		fail("", usageError{"invalid filename format: " + filename})
+	}
+	name := matches[1]
+	extension := matches[2]
 	commandRe := regexp.MustCompile(`^(.*?)(_.*)?$`)
-    commandMatches := commandRe.FindStringSubmatch(name)
-    if len(commandMatches) < 2 {
-        fmt.Printf("%sInvalid command format in filename: %s%s\n", red, filename, reset)
-        os.Exit(64)
-    }
-    commandName := commandMatches[1]
+	commandMatches := commandRe.FindStringSubmatch(name)
+	if len(commandMatches) < 2 {
+		fail("", usageError{"invalid command format in filename: " + filename})
+	}
+	commandName := commandMatches[1]
 	commandObject := commandMatches[2]
-	fmt.Printf("%sRunning command %s (name: %s, extension: %s)%s\n", cyan, commandName, name, extension, reset)
-    //fmt.Printf("%sRunning file %s (name: %s, extension: %s)%s\n", cyan, filename, name, extension, reset)
+	console.Printf("%sRunning command %s (name: %s, extension: %s)%s\n", cyan, commandName, name, extension, reset)
 	file, err := os.Open(filename)
 	if err != nil {
-		fmt.Printf("%sCould not open file %s%s\n", red, filename, reset)
-		os.Exit(74)
+		fail("opening file", err)
 	}
 	defer file.Close()
 
-
+	ctx := strings.TrimPrefix(commandObject, "_")
+	if !cli.Default.HasContext(ctx) {
+		fail("", usageError{"invalid command object in filename: " + filename})
+	}
+	// Every line is run even after one fails; gocli then exits with the
+	// status of the first failure.
+	var firstErr error
+	failed, total := 0, 0
 	scanner := bufio.NewScanner(file)
-	if (commandObject == "_admin"){
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-			line =commandName + " " + line
-			fmt.Printf("%s>%s %s\n", blue, reset, line)
-			run1(line, db)
-			if haderror {
-				haderror = false
-			}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
 		}
-	}else if (commandObject == "_flag"){
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.TrimSpace(line) == "" {
-				continue
-			}
-			line =commandName + " " + line
-			fmt.Printf("%s>%s %s\n", blue, reset, line)
-			run2(line, db)
-			if haderror {
-				haderror = false
+		line = commandName + " " + line
+		console.Printf("%s>%s %s\n", blue, reset, line)
+		total++
+		if err := dispatch(ctx, line, st); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
 			}
 		}
-	} else {
-		fmt.Printf("%sInvalid command object in filename: %s%s\n", red, filename, reset)
-		os.Exit(64)
+	}
+	if err := scanner.Err(); err != nil {
+		fail("reading "+filename, err)
+	}
+	if firstErr != nil {
+		console.Printf("%s%d of %d commands failed%s\n", red, failed, total, reset)
+		file.Close()
+		os.Exit(exitCode(firstErr))
 	}
 }
 
+func registerAdminCommands() {
+	cli.Register("admin", &cli.Func{
+		Use:          "add <email>",
+		Short:        "add an admin",
+		CompleteFunc: completeUsers,
+		RunFunc: func(st store.Store, args []string) error {
+			if err := AddAdmin(args[0], st); err != nil {
+				return userOpError("adding admin", args[0], err, st)
+			}
+			console.Printf("%sAdmin added successfully%s\n", green, reset)
+			return nil
+		},
+	})
+	cli.Register("admin", &cli.Func{
+		Use:          "delete <email>",
+		Short:        "delete an admin",
+		CompleteFunc: completeAdmins,
+		RunFunc: func(st store.Store, args []string) error {
+			if err := DeleteAdmin(args[0], st); err != nil {
+				return userOpError("deleting admin", args[0], err, st)
+			}
+			console.Printf("%sAdmin deleted successfully%s\n", green, reset)
+			return nil
+		},
+	})
+	cli.Register("admin", &cli.Func{
+		Use:          "modify <email>",
+		Short:        "modify an admin",
+		CompleteFunc: completeAdmins,
+		RunFunc: func(st store.Store, args []string) error {
+			if err := ModifyAdmin(args[0], st); err != nil {
+				return userOpError("modifying admin", args[0], err, st)
+			}
+			console.Printf("%sAdmin modified successfully%s\n", green, reset)
+			return nil
+		},
+	})
+	cli.Register("admin", &cli.Func{
+		Use:          "import <file>",
+		Short:        "import admins from a csv/json file",
+		CompleteFunc: completeFiles,
+		RunFunc: func(st store.Store, args []string) error {
+			added, updated, err := ImportAdmins(args[0], st)
+			if err != nil {
+				return fmt.Errorf("importing admins: %w", err)
+			}
+			console.Printf("%sAdmins imported successfully (%d added, %d updated)%s\n", green, added, updated, reset)
+			return nil
+		},
+	})
+	cli.Register("admin", &cli.Func{
+		Use:          "export [file]",
+		Short:        "export admins to a csv/json file",
+		CompleteFunc: completeFiles,
+		RunFunc: func(st store.Store, args []string) error {
+			filename := ""
+			if len(args) > 0 {
+				filename = args[0]
+			}
+			count, err := ExportAdmins(filename, st)
+			if err != nil {
+				return fmt.Errorf("exporting admins: %w", err)
+			}
+			if filename != "" {
+				console.Printf("%sExported %d admins to %s%s\n", green, count, filename, reset)
+			}
+			return nil
+		},
+	})
+	cli.Register("admin", &cli.Func{
+		Use:   "matrix",
+		Short: "see the permissions of every admin",
+		RunFunc: func(st store.Store, args []string) error {
+			if err := printAdminMatrix(st); err != nil {
+				return fmt.Errorf("listing admins: %w", err)
+			}
+			return nil
+		},
+	})
+}
 
-
-func run1(source string, db *sql.DB) {
-	words := strings.Fields(source)
-	if len(words) == 0 {
-		fmt.Printf("%sError: empty command%s\n", red, reset)
-		haderror = true
-		return
-	}
-
-	firstWord := words[0]
-	switch firstWord {
-	case "add":
-		if len(words) < 2 {
-			fmt.Printf("%sError: missing email for add command%s\n", red, reset)
-			haderror = true
-			return
-		}
-		email := words[1]
-		err := AddAdmin(email, db)
-		if err != nil {
-			fmt.Printf("%sError adding admin: %v%s\n", red, err, reset)
-			haderror = true
-		} else {
-			fmt.Printf("%sAdmin added successfully%s\n", green, reset)
-		}
-	case "delete":
-		if len(words) < 2 {
-			fmt.Printf("%sError: missing email for delete command%s\n", red, reset)
-			haderror = true
-			return
-		}
-		email := words[1]
-		err := DeleteAdmin(email, db)
+// askForAccess returns 1 to grant accessType, 0 to deny it and -1 to keep
+// it as it is. Answering q returns ui.ErrCancelled.
+func askForAccess(accessType string) (int, error) {
+	for {
+		input, err := console.Ask(fmt.Sprintf("%sGrant %s access? (y/n): %s", yellow, accessType, reset))
 		if err != nil {
-			fmt.Printf("%sError deleting admin: %v%s\n", red, err, reset)
-			haderror = true
-		} else {
-			fmt.Printf("%sAdmin deleted successfully%s\n", green, reset)
+			return 0, err
 		}
-	case "modify":
-		if len(words) < 2 {
-			fmt.Printf("%sError: missing email for modify command%s\n", red, reset)
-			haderror = true
-			return
+		input = strings.ToLower(input)
+		if input == "y" || input == "t" {
+			return 1, nil
+		} else if input == "n" || input == "f" {
+			return 0, nil
+		} else if input == "" {
+			return -1, nil
+		} else if input == "exit" || input == "quit" || input == "q" {
+			return 0, ui.ErrCancelled
 		}
-		email := words[1]
-		err := ModifyAdmin(email, db)
-		if err != nil {
-			fmt.Printf("%sError modifying admin: %v%s\n", red, err, reset)
-			haderror = true
-		} else {
-			fmt.Printf("%sAdmin modified successfully%s\n", green, reset)
-		}
-	default:
-		fmt.Printf("%sError: unknown command %s%s\n", red, firstWord, reset)
-		printAdminUsage()
-		haderror = true
+		console.Printf("%sInvalid input. Please enter 'y' for yes or 'n' for no.%s\n", red, reset)
 	}
 }
 
-func CheckUser(email string, db *sql.DB) (*User, error) {
-	query := `SELECT id, email, name FROM users WHERE email=$1`
-	row := db.QueryRow(query, email)
-	var user User
-	err := row.Scan(&user.ID, &user.Email, &user.Name)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+// askForPermissions asks for each permission of admin in turn, keeping
+// the current value when the answer is left empty. admin is left
+// partially changed if the user cancels.
+func askForPermissions(admin *store.Admin) error {
+	fields := []*bool{&admin.CheckinAccess, &admin.AnticheatAccess, &admin.QrmgmtAccess,
+		&admin.QuestionManagementAccess, &admin.CommunicationAccess}
+	for i, field := range fields {
+		access, err := askForAccess(accessNames[i])
+		if err != nil {
+			return err
+		}
+		if access != -1 {
+			*field = access == 1
 		}
-		return nil, errors.New("error scanning row")
 	}
-	return &user, nil
-}
-
-func askForAccess(accessType string) int {
-    var input string
-    for {
-        fmt.Printf("%sGrant %s access? (y/n): %s", yellow, accessType, reset)
-        fmt.Scanln(&input)
-        input = strings.ToLower(strings.TrimSpace(input))
-        if input == "y" ||  input == "t" {
-            return 1
-        } else if input == "n" || input == "f" {
-            return 0
-        } else if input == "" {
-            return -1
-        } else if input == "exit" || input == "quit" || input == "q" {
-            os.Exit(0)
-        }
-        fmt.Printf("%sInvalid input. Please enter 'y' for yes or 'n' for no.%s\n", red, reset)
-    }
-}
-
-func NewAdmin(user User) Admin {
-    return Admin{
-        Base:                     NewBase(),
-        CheckinAccess:            false,
-        AnticheatAccess:          false,
-        QrmgmtAccess:             false,
-        QuestionManagementAccess: false,
-        CommunicationAccess:      false,
-        UserID:                   user.ID,
-        User:                     user,
-    }
+	return nil
 }
 
-func AddAdmin(email string, db *sql.DB) error {
-	user, err := CheckUser(email, db)
+func AddAdmin(email string, st store.Store) error {
+	email, err := mailaddr.Normalize(email)
 	if err != nil {
 		return err
 	}
-
-	var existingAdminID string
-	err = db.QueryRow("SELECT id FROM admins WHERE user_id = $1", user.ID).Scan(&existingAdminID)
-	if err != nil && err != sql.ErrNoRows {
+	user, err := findUser(email, st)
+	if err != nil {
 		return err
 	}
-	if existingAdminID != "" {
-		return errors.New("admin already exists")
-	}
-
-	admin := NewAdmin(*user)
-
-	checkinAccess := askForAccess("Checkin")
-    if checkinAccess != -1 {
-        admin.CheckinAccess = checkinAccess == 1
-    }
-    anticheatAccess := askForAccess("Anticheat")
-    if anticheatAccess != -1 {
-        admin.AnticheatAccess = anticheatAccess == 1
-    }
-    qrmgmtAccess := askForAccess("Qr Management")
-    if qrmgmtAccess != -1 {
-        admin.QrmgmtAccess = qrmgmtAccess == 1
-    }
-    questionManagementAccess := askForAccess("Question Management")
-    if questionManagementAccess != -1 {
-        admin.QuestionManagementAccess = questionManagementAccess == 1
-    }
-    communicationAccess := askForAccess("Communication")
-    if communicationAccess != -1 {
-        admin.CommunicationAccess = communicationAccess == 1
-    }
-
-
-	_, err = db.Exec(`
-		INSERT INTO admins (id, checkin_access, anticheat_access, qrmgmt_access,
-		question_management_access, communication_access, user_id,
-		created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, admin.ID, admin.CheckinAccess, admin.AnticheatAccess, admin.QrmgmtAccess,
-		admin.QuestionManagementAccess, admin.CommunicationAccess, admin.UserID,
-		admin.CreatedAt, admin.UpdatedAt)
-	if err != nil {
+	if _, err := st.GetAdmin(user.ID); err == nil {
+		return store.ErrAdminExists
+	} else if !errors.Is(err, store.ErrAdminNotFound) {
 		return err
 	}
 
-	return nil
-}
-
-func GetAdminId(userID string, db *sql.DB) (string,error) {
-	var adminID string
-	err := db.QueryRow(`SELECT id FROM admins WHERE user_id = $1`, userID).Scan(&adminID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return adminID, errors.New("Admin not found")
-		}
-		return adminID, err
+	admin := store.NewAdmin(*user)
+	if err := askForPermissions(&admin); err != nil {
+		return err
 	}
-	return adminID, nil
+	return st.CreateAdmin(&admin)
 }
 
-func DeleteAdmin(email string, db *sql.DB) error {
-	user, err := CheckUser(email, db)
-	if err != nil {
-		return err
-	}
-	admin, err := GetAdminId(user.ID, db)
+func DeleteAdmin(email string, st store.Store) error {
+	email, err := mailaddr.Normalize(email)
 	if err != nil {
 		return err
 	}
-	_, er := db.Exec("DELETE FROM qr_data where admin_id = $1", admin)
-	if er != nil {
-		return er
-	}
-	result, err := db.Exec("DELETE FROM admins WHERE user_id = $1", user.ID)
+	user, err := findUser(email, st)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	admin, err := st.GetAdmin(user.ID)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return errors.New("admin not found")
-	}
-	return nil
+	return st.DeleteAdmin(admin.ID)
 }
 
-func printAdminDetails(user User, existingAdmin Admin) {
-	headers := []string{"Detail", "Value"}
-	rows := [][]string{
-		{"Name", user.Name},
-		{"Checkin Access", fmt.Sprintf("%t", existingAdmin.CheckinAccess)},
-		{"Anticheat Access", fmt.Sprintf("%t", existingAdmin.AnticheatAccess)},
-		{"QR Management Access", fmt.Sprintf("%t", existingAdmin.QrmgmtAccess)},
-		{"Question Management Access", fmt.Sprintf("%t", existingAdmin.QuestionManagementAccess)},
-		{"Communication Access", fmt.Sprintf("%t", existingAdmin.CommunicationAccess)},
-	}
-
-	detailWidth := len(headers[0])
-	valueWidth := len(headers[1])
-	for _, row := range rows {
-		if len(row[0]) > detailWidth {
-			detailWidth = len(row[0])
-		}
-		if len(row[1]) > valueWidth {
-			valueWidth = len(row[1])
-		}
-	}
-
-	fmt.Printf("%sDetails of the admin are as follows:%s\n", cyan, reset)
-	fmt.Printf("+-%s-+-%s-+\n", strings.Repeat("-", detailWidth), strings.Repeat("-", valueWidth))
-	printTableRow(detailWidth, valueWidth, headers[0], headers[1], magenta+bold)
-	for _, row := range rows {
-		printTableRow(detailWidth, valueWidth, row[0], row[1], "")
-	}
+func printAdminDetails(user store.User, existingAdmin store.Admin) {
+	table := newTable("Detail", "Value")
+	table.Separators = true
+	table.AddRow("", "Name", user.Name)
+	table.AddRow("", "Checkin Access", fmt.Sprintf("%t", existingAdmin.CheckinAccess))
+	table.AddRow("", "Anticheat Access", fmt.Sprintf("%t", existingAdmin.AnticheatAccess))
+	table.AddRow("", "QR Management Access", fmt.Sprintf("%t", existingAdmin.QrmgmtAccess))
+	table.AddRow("", "Question Management Access", fmt.Sprintf("%t", existingAdmin.QuestionManagementAccess))
+	table.AddRow("", "Communication Access", fmt.Sprintf("%t", existingAdmin.CommunicationAccess))
+
+	console.Printf("%sDetails of the admin are as follows:%s\n", cyan, reset)
+	console.PrintTable(table)
 }
 
-func printTableRow(detailWidth, valueWidth int, detail, value string, colorCode string) {
-	fmt.Printf("| %s%-*s%s | %s%-*s%s |\n",
-		colorCode, detailWidth, detail, reset,
-		colorCode, valueWidth, value, reset)
-	fmt.Printf("+-%s-+-%s-+\n", strings.Repeat("-", detailWidth), strings.Repeat("-", valueWidth))
+// newTable returns a table with the header style used throughout gocli.
+func newTable(headers ...string) *ui.Table {
+	return &ui.Table{Headers: headers, HeaderStyle: magenta + bold}
 }
 
-func ModifyAdmin(email string, db *sql.DB) error {
-	user, err := CheckUser(email, db)
+func ModifyAdmin(email string, st store.Store) error {
+	email, err := mailaddr.Normalize(email)
 	if err != nil {
 		return err
 	}
-
-	var existingAdmin Admin
-	err = db.QueryRow(`SELECT id, checkin_access, anticheat_access, qrmgmt_access,
-		question_management_access, communication_access, user_id, created_at, updated_at
-		FROM admins WHERE user_id = $1`, user.ID).
-		Scan(&existingAdmin.ID, &existingAdmin.CheckinAccess, &existingAdmin.AnticheatAccess,
-			&existingAdmin.QrmgmtAccess, &existingAdmin.QuestionManagementAccess,
-			&existingAdmin.CommunicationAccess, &existingAdmin.UserID,
-			&existingAdmin.CreatedAt, &existingAdmin.UpdatedAt)
+	user, err := findUser(email, st)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return errors.New("admin not found")
-		}
 		return err
 	}
-
-	printAdminDetails(*user, existingAdmin)
-
-	checkinAccess := askForAccess("Checkin")
-    if checkinAccess != -1 {
-        existingAdmin.CheckinAccess = checkinAccess == 1
-    }
-    anticheatAccess := askForAccess("Anticheat")
-    if anticheatAccess != -1 {
-        existingAdmin.AnticheatAccess = anticheatAccess == 1
-    }
-    qrmgmtAccess := askForAccess("Qr Management")
-    if qrmgmtAccess != -1 {
-        existingAdmin.QrmgmtAccess = qrmgmtAccess == 1
-    }
-    questionManagementAccess := askForAccess("Question Management")
-    if questionManagementAccess != -1 {
-        existingAdmin.QuestionManagementAccess = questionManagementAccess == 1
-    }
-    communicationAccess := askForAccess("Communication")
-    if communicationAccess != -1 {
-        existingAdmin.CommunicationAccess = communicationAccess == 1
-    }
-
-	_, err = db.Exec(`
-		UPDATE admins SET checkin_access = $1, anticheat_access = $2, qrmgmt_access = $3,
-		question_management_access = $4, communication_access = $5, updated_at = $6
-		WHERE user_id = $7
-	`, existingAdmin.CheckinAccess, existingAdmin.AnticheatAccess, existingAdmin.QrmgmtAccess,
-	existingAdmin.QuestionManagementAccess, existingAdmin.CommunicationAccess, existingAdmin.UpdatedAt, existingAdmin.UserID)
+	existingAdmin, err := st.GetAdmin(user.ID)
 	if err != nil {
 		return err
 	}
-	printAdminDetails(*user, existingAdmin)
+
+	printAdminDetails(*user, *existingAdmin)
+	if err := askForPermissions(existingAdmin); err != nil {
+		return err
+	}
+	if err := st.UpdateAdmin(existingAdmin); err != nil {
+		return err
+	}
+	printAdminDetails(*user, *existingAdmin)
 	return nil
 }
 
-func printFlagDetails(db *sql.DB) {
-	headers := []string{"Flag", "Value"}
-	var flags []Flag
-	rows, err := db.Query("SELECT name, value FROM flags")
+// printFlagDetails prints every flag, or only those in group when it is
+// not empty.
+func printFlagDetails(group string, st store.Store) error {
+	flags, err := st.ListFlags()
 	if err != nil {
-		fmt.Printf("%sError: %v%s\n", red, err, reset)
-		haderror = true
-		return
+		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var flag Flag
-		err = rows.Scan(&flag.Name, &flag.Value)
-		if err != nil {
-			fmt.Printf("%sError: %v%s\n", red, err, reset)
-			haderror = true
-			return
+	table := newTable("Flag", "Value", "Group", "Owner", "Description", "Created", "Updated")
+	table.Separators = true
+	shown := 0
+	for _, flag := range flags {
+		if group != "" && !flag.InGroup(group) {
+			continue
 		}
-		flags = append(flags, flag)
+		table.AddRow("", flag.Name, fmt.Sprintf("%t", flag.Value), orDash(flag.Group()),
+			orDash(flag.Owner), orDash(flag.Description), formatFlagTime(flag.CreatedAt), formatFlagTime(flag.UpdatedAt))
+		shown++
 	}
-	detailWidth := len(headers[0])
-	valueWidth := len(headers[1])
-	for _, row := range flags {
-		if len(row.Name) > detailWidth {
-			detailWidth = len(row.Name)
-		}
-		if len(fmt.Sprintf("%t", row.Value)) > valueWidth {
-			valueWidth = len(fmt.Sprintf("%t", row.Value))
-		}
+	if group != "" && shown == 0 {
+		console.Printf("%sNo flags in group %s%s\n", yellow, group, reset)
+		return nil
 	}
 
-	fmt.Printf("%sDetails of the flags are as follows:%s\n", cyan, reset)
-	fmt.Printf("+-%s-+-%s-+\n", strings.Repeat("-", detailWidth), strings.Repeat("-", valueWidth))
-	printTableRow(detailWidth, valueWidth, headers[0], headers[1], magenta+bold)
-	for _, row := range flags {
-		printTableRow(detailWidth, valueWidth, row.Name, fmt.Sprintf("%t", row.Value), "")
-	}
+	console.Printf("%sDetails of the flags are as follows:%s\n", cyan, reset)
+	console.PrintTable(table)
+	return nil
 }
 
-func run2(source string, db *sql.DB) {
-	words := strings.Fields(source)
-	if len(words) == 0 {
-		fmt.Printf("%sError: empty command%s\n", red, reset)
-		haderror = true
-		return
-	}
-
-	firstWord := words[0]
-	switch firstWord {
-	case "see":
-		printFlagDetails(db)
-	case "set":
-		if len(words) < 2 {
-			fmt.Printf("%sError: missing flag name%s\n", red, reset)
-			haderror = true
-			return
-		}
-		flag := words[1]
-		err := SetFlag(flag, db)
-		if err != nil {
-			fmt.Printf("%sError setting flag %v%s\n", red, err, reset)
-			haderror = true
-		} else {
-			fmt.Printf("%sFlag set successfully%s\n", green, reset)
-		}
-	case "reset":
-		if len(words) < 2 {
-			fmt.Printf("%sError: missing flag name%s\n", red, reset)
-			haderror = true
-			return
-		}
-		flag := words[1]
-		err := ResetFlag(flag, db)
-		if err != nil {
-			fmt.Printf("%sError resetting flag %v%s\n", red, err, reset)
-			haderror = true
-		} else {
-			fmt.Printf("%sFlag reset successfully%s\n", green, reset)
-		}
-	default:
-		fmt.Printf("%sError: unknown command %s%s\n", red, firstWord, reset)
-		printFlagUsage()
-		haderror = true
+func orDash(s string) string {
+	if s == "" {
+		return "-"
 	}
+	return s
 }
 
-func SetFlag(flag string, db *sql.DB) error {
-	var existingFlag Flag
-	err := db.QueryRow(`SELECT name, value FROM flags WHERE name = $1`, flag).
-		Scan(&existingFlag.Name, &existingFlag.Value)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return errors.New("flag not found")
-		}
-		return err
-	}
-
-	_, err = db.Exec(`
-		UPDATE flags SET value = $1 WHERE name = $2
-	`, true, flag)
-	if err != nil {
-		return err
+// formatFlagTime shows when a flag was created or updated, or "-" for the
+// flags made before that was recorded.
+func formatFlagTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
 	}
-	return nil
+	return t.Local().Format(time.DateTime)
 }
 
-func ResetFlag(flag string, db *sql.DB) error {
-	var existingFlag Flag
-	err := db.QueryRow(`SELECT name, value FROM flags WHERE name = $1`, flag).
-		Scan(&existingFlag.Name, &existingFlag.Value)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return errors.New("flag not found")
-		}
-		return err
+// setFlags sets a flag, or with a pattern such as "checkin.*" every flag
+// in that group at once, and returns how many it set.
+func setFlags(pattern string, value bool, st store.Store) (int, error) {
+	group, ok := strings.CutSuffix(pattern, ".*")
+	if !ok {
+		return 1, st.SetFlag(pattern, value)
 	}
-
-	_, err = db.Exec(`
-		UPDATE flags SET value = $1 WHERE name = $2
-	`, false, flag)
+	flags, err := st.ListFlags()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
-}
-
-func run3(source string, db *sql.DB) {
-	words := strings.Fields(source)
-	if len(words) == 0 {
-		fmt.Printf("%sError: empty command%s\n", red, reset)
-		haderror = true
-		return
-	}
-
-	firstWord := words[0]
-	switch firstWord {
-	case "add":
-		err := AddWhitelist(db)
-		if err != nil {
-			fmt.Printf("%sError adding whitelist: %v%s\n", red, err, reset)
-			haderror = true
-		} else {
-			fmt.Printf("%sWhitelist added successfully%s\n", green, reset)
+	count := 0
+	err = st.Tx(func(tx store.Store) error {
+		for _, flag := range flags {
+			if !flag.InGroup(group) {
+				continue
+			}
+			if err := tx.SetFlag(flag.Name, value); err != nil {
+				return err
+			}
+			count++
 		}
-	default:
-		fmt.Printf("%sError: unknown command %s%s\n", red, firstWord, reset)
-		printWhitelist()
-		haderror = true
+		if count == 0 {
+			return store.ErrFlagNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return count, nil
 }
 
-func AddWhitelist(db *sql.DB) error {
-    file, err := os.Open("whitelist.csv")
-    if err != nil {
-        fmt.Printf("%sCould not open file whitelist.csv%s\n", red, reset)
-        return err
-    }
-
-    defer file.Close()
-    scanner := bufio.NewScanner(file)
-
-    // Skip the first header line
-    if scanner.Scan() {
-        header := scanner.Text()
-        fmt.Printf("%sSkipping header: %s%s\n", cyan, header, reset)
-    }
-
-    for scanner.Scan() {
-        line := scanner.Text()
-        if strings.TrimSpace(line) == "" {
-            continue
-        }
-        words := strings.Split(line, ",")
-        if len(words) < 3 {
-            fmt.Printf("%sError: invalid format in whitelist.csv%s\n", red, reset)
-            return errors.New("invalid format")
-        }
-
-        name := words[0]
-        email := words[2]
-
-		user,_ := CheckUser(email, db)
-		id := uuid.New().String()
-		fmt.Println(user)
-		if user == nil {
-			fmt.Printf("%sUser not found: %s%s\n", red, email, reset)
-			_, err = db.Exec(`INSERT INTO whitelists (id, name, email) VALUES ($1, $2, $3)`, id, name, email)
+func registerFlagCommands() {
+	cli.Register("flag", &cli.Func{
+		Use:          "see [group]",
+		Short:        "see all flags, or those in a group",
+		CompleteFunc: completeFlagGroups,
+		RunFunc: func(st store.Store, args []string) error {
+			group := ""
+			if len(args) > 0 {
+				group = strings.TrimSuffix(args[0], ".*")
+			}
+			if err := printFlagDetails(group, st); err != nil {
+				return fmt.Errorf("listing flags: %w", err)
+			}
+			return nil
+		},
+	})
+	cli.Register("flag", &cli.Func{
+		Use:          "set <flag>",
+		Short:        "set flag, or every flag of a group such as checkin.*, to true",
+		CompleteFunc: completeFlags,
+		RunFunc: func(st store.Store, args []string) error {
+			count, err := setFlags(args[0], true, st)
 			if err != nil {
-				fmt.Printf("%sError inserting into whitelist: %v%s\n", red, err, reset)
+				return &opError{op: "setting flag", subject: args[0], err: err}
 			}
-		} else {
-			_, err = db.Exec(`INSERT INTO whitelists (id, name, email,user_id) VALUES ($1, $2, $3, $4)`, id, name, email, user.ID)
+			if count > 1 {
+				console.Printf("%s%d flags set successfully%s\n", green, count, reset)
+			} else {
+				console.Printf("%sFlag set successfully%s\n", green, reset)
+			}
+			return nil
+		},
+	})
+	cli.Register("flag", &cli.Func{
+		Use:          "reset <flag>",
+		Short:        "set flag, or every flag of a group such as checkin.*, to false",
+		CompleteFunc: completeFlags,
+		RunFunc: func(st store.Store, args []string) error {
+			count, err := setFlags(args[0], false, st)
 			if err != nil {
-				fmt.Printf("%sError inserting into whitelist: %v%s\n", red, err, reset)
-				return err
+				return &opError{op: "resetting flag", subject: args[0], err: err}
 			}
-		}
-
-		
-        fmt.Printf("%sProcessing: Name=%s, Email=%s%s\n", green, name, email, reset)
-    }
-
-    if err := scanner.Err(); err != nil {
-        fmt.Printf("%sError reading file: %v%s\n", red, err, reset)
-        return err
-    }
-    return nil
-}
\ No newline at end of file
+			if count > 1 {
+				console.Printf("%s%d flags reset successfully%s\n", green, count, reset)
+			} else {
+				console.Printf("%sFlag reset successfully%s\n", green, reset)
+			}
+			return nil
+		},
+	})
+	cli.Register("flag", &cli.Func{
+		Use:          "describe <flag> <owner> <description>...",
+		Short:        "record what a flag is for and who owns it",
+		CompleteFunc: completeFlags,
+		RunFunc: func(st store.Store, args []string) error {
+			if err := st.DescribeFlag(args[0], args[1], strings.Join(args[2:], " ")); err != nil {
+				return &opError{op: "describing flag", subject: args[0], err: err}
+			}
+			console.Printf("%sFlag described successfully%s\n", green, reset)
+			return nil
+		},
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/qwerty-dvorak/gocli/basic"
+	"github.com/qwerty-dvorak/gocli/cli"
+	"github.com/qwerty-dvorak/gocli/store"
+	"github.com/qwerty-dvorak/gocli/ui"
+)
+
+// testPostgresURL is the Postgres server openTestDB gives each test a
+// schema on: TEST_DATABASE_URL or, failing that, an embedded server
+// started for the run. With -short and no TEST_DATABASE_URL it is empty
+// and the tests run on SQLite instead; otherwise a run without Postgres
+// fails rather than quietly testing something else.
+var testPostgresURL string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	testPostgresURL = os.Getenv("TEST_DATABASE_URL")
+	stop := func() {}
+	if testPostgresURL == "" && !testing.Short() {
+		var err error
+		if testPostgresURL, stop, err = startEmbeddedPostgres(); err != nil {
+			fmt.Fprintf(os.Stderr, "no Postgres to test on: %v\nSet TEST_DATABASE_URL, or run with -short to test on SQLite.\n", err)
+			os.Exit(1)
+		}
+	}
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// openTestDB returns a database with nothing in it. On Postgres each test
+// gets its own schema, dropped when the test ends, with the tables of the
+// main application migrated as "./main migrate" would; on SQLite it gets
+// a file in a temporary directory with gocli's own schema.
+func openTestDB(t *testing.T) (*sql.DB, store.Store) {
+	t.Helper()
+	if testPostgresURL != "" {
+		db := openTestSchema(t, testPostgresURL)
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Exec(postgresSchema); err != nil {
+			t.Fatalf("creating schema: %v", err)
+		}
+		if _, err := store.Migrate(db, store.DriverPostgres); err != nil {
+			t.Fatalf("migrating schema: %v", err)
+		}
+		st, err := store.Open(db, store.DriverPostgres)
+		if err != nil {
+			t.Fatalf("opening store: %v", err)
+		}
+		return db, st
+	}
+
+	db, driver, err := basic.Open("sqlite://" + filepath.Join(t.TempDir(), "gocli.db"))
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := store.CreateSchema(db, driver); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	st, err := store.Open(db, driver)
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	return db, st
+}
+
+// openTestSchema creates a throwaway Postgres schema and returns a
+// connection whose search_path points at it.
+func openTestSchema(t *testing.T, databaseURL string) *sql.DB {
+	t.Helper()
+	admin, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	name := "gocli_test_" + uuid.New().String()[:8]
+	if _, err := admin.Exec("CREATE SCHEMA " + name); err != nil {
+		admin.Close()
+		t.Fatalf("creating test schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + name + " CASCADE")
+		admin.Close()
+	})
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatalf("the test database must have a URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", name)
+	u.RawQuery = query.Encode()
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("opening test schema: %v", err)
+	}
+	return db
+}
+
+func addTestUser(t *testing.T, db *sql.DB, email string) store.User {
+	t.Helper()
+	user := store.User{Base: store.NewBase(), Email: email, Name: email}
+	if _, err := db.Exec(`INSERT INTO users (id, email, name) VALUES ($1, $2, $3)`,
+		user.ID, user.Email, user.Name); err != nil {
+		t.Fatalf("adding user %s: %v", email, err)
+	}
+	return user
+}
+
+func addTestFlag(t *testing.T, db *sql.DB, name string, value bool) {
+	t.Helper()
+	if _, err := db.Exec(`INSERT INTO flags (name, value) VALUES ($1, $2)`, name, value); err != nil {
+		t.Fatalf("adding flag %s: %v", name, err)
+	}
+}
+
+// withStdio runs fn with input as the answers to prompts and returns
+// what it printed.
+func withStdio(t *testing.T, input string, fn func()) string {
+	t.Helper()
+	var output strings.Builder
+	saved := console
+	console = ui.New(strings.NewReader(input), &output, &output)
+	defer func() { console = saved }()
+	fn()
+	return output.String()
+}
+
+func registeredCommand(t *testing.T, context, name string) cli.Command {
+	t.Helper()
+	cmd := cli.Default.Lookup(context, name)
+	if cmd == nil {
+		t.Fatalf("no %s command in %s", name, context)
+	}
+	return cmd
+}
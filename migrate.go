@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/qwerty-dvorak/gocli/basic"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// runMigrate adds the columns gocli needs to the configured database.
+// Connecting never alters a database, so this is run once after
+// upgrading gocli, or left to the main application's own migrations.
+func runMigrate(args []string) {
+	if len(args) > 0 {
+		fail("", usageError{"migrate takes no arguments"})
+	}
+	db, driver, err := basic.NewSession()
+	if err != nil {
+		fail("connecting to database", connectionError(err))
+	}
+	defer db.Close()
+
+	changes, err := store.Migrate(db, driver)
+	for _, change := range changes {
+		console.Printf("%s+ %s%s\n", green, change, reset)
+	}
+	if err != nil {
+		db.Close()
+		fail("migrating database", err)
+	}
+	if len(changes) == 0 {
+		console.Printf("%sNo changes, database schema is up to date%s\n", green, reset)
+		return
+	}
+	console.Printf("%sApplied %d changes%s\n", green, len(changes), reset)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// postgresSchema creates the tables of the main application in a test
+// schema.
+//
+//go:embed testdata/postgres_schema.sql
+var postgresSchema string
+
+// startEmbeddedPostgres starts a throwaway Postgres server, downloading it
+// on first use, and returns its URL and a function that stops it.
+func startEmbeddedPostgres() (string, func(), error) {
+	dir, err := os.MkdirTemp("", "gocli-postgres")
+	if err != nil {
+		return "", nil, err
+	}
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	config := embeddedpostgres.DefaultConfig().
+		Port(uint32(port)).
+		RuntimePath(dir).
+		StartTimeout(time.Minute).
+		Logger(io.Discard)
+	server := embeddedpostgres.NewDatabase(config)
+	if err := server.Start(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	stop := func() {
+		if err := server.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "stopping embedded Postgres: %v\n", err)
+		}
+		os.RemoveAll(dir)
+	}
+	return config.GetConnectionURL() + "?sslmode=disable", stop, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+
+	"github.com/qwerty-dvorak/gocli/cli"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// completionLimit caps how many emails are fetched for a single tab press.
+const completionLimit = 100
+
+// newReadline returns a line editor for the prompt, starting in a context
+// such as "admin", with tab completion and history kept in
+// ~/.gocli_history/<context>. It returns nil when stdin is not a terminal,
+// where line editing makes no sense and the console reads plain lines.
+func newReadline(context string, completer readline.AutoCompleter) *readline.Instance {
+	if !readline.DefaultIsTerminal() {
+		return nil
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:            fmt.Sprintf("%s>%s ", blue, reset),
+		HistoryFile:       historyFile(context),
+		HistorySearchFold: true,
+		AutoComplete:      completer,
+		Stdout:            console.Out,
+		Stderr:            console.Err,
+	})
+	if err != nil {
+		return nil
+	}
+	return rl
+}
+
+// historyFile returns the history file for a context, or "" to keep
+// history in memory only when the home directory is unavailable.
+func historyFile(context string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(home, ".gocli_history")
+	if err := migrateHistoryFile(dir); err != nil {
+		slog.Warn("could not move the old history file into a directory", "path", dir, "error", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		slog.Warn("history is not saved", "path", dir, "error", err)
+		return ""
+	}
+	return filepath.Join(dir, context)
+}
+
+// migrateHistoryFile turns the single history file that path used to be,
+// shared by every prompt, into the directory of per-context files, each
+// starting with the old history. The old file is kept as path.old until
+// the new ones are written.
+func migrateHistoryFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	history, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	old := path + ".old"
+	if err := os.Rename(path, old); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return err
+	}
+	for _, context := range cli.Default.Contexts() {
+		if err := os.WriteFile(filepath.Join(path, context), history, 0o600); err != nil {
+			return err
+		}
+	}
+	return os.Remove(old)
+}
+
+// readPromptLine reads the next command, skipping lines cancelled with
+// Ctrl-C. It returns false when input is exhausted.
+func readPromptLine() (string, bool) {
+	for {
+		line, err := console.ReadLine()
+		if err == readline.ErrInterrupt {
+			continue
+		}
+		if err != nil {
+			console.Println()
+			return "", false
+		}
+		return strings.TrimSpace(line), true
+	}
+}
+
+func completeUsers(st store.Store, line string) []string {
+	prefix := lastWord(line)
+	emails, _ := st.UserEmails(prefix, completionLimit)
+	return completeFolded(prefix, emails)
+}
+
+func completeAdmins(st store.Store, line string) []string {
+	admins, err := st.ListAdmins()
+	if err != nil {
+		return nil
+	}
+	emails := make([]string, len(admins))
+	for i, admin := range admins {
+		emails[i] = admin.User.Email
+	}
+	return completeFolded(lastWord(line), emails)
+}
+
+// completeFolded returns the emails that start with prefix, ignoring
+// case, completed from prefix as typed: readline only ever appends to
+// what was typed, and emails are looked up ignoring case anyway.
+func completeFolded(prefix string, emails []string) []string {
+	n := utf8.RuneCountInString(prefix)
+	var completions []string
+	for _, email := range emails {
+		runes := []rune(email)
+		if len(runes) >= n && strings.EqualFold(string(runes[:n]), prefix) {
+			completions = append(completions, prefix+string(runes[n:]))
+		}
+	}
+	return completions
+}
+
+func completeFlags(st store.Store, line string) []string {
+	flags, err := st.ListFlags()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, flag := range flags {
+		names = append(names, flag.Name)
+	}
+	return append(names, flagGroupPatterns(flags)...)
+}
+
+// completeFlagGroups completes the groups of the flags.
+func completeFlagGroups(st store.Store, line string) []string {
+	flags, err := st.ListFlags()
+	if err != nil {
+		return nil
+	}
+	return flagGroupPatterns(flags)
+}
+
+// flagGroupPatterns returns the pattern, such as "checkin.*", of every
+// group that flags are in.
+func flagGroupPatterns(flags []store.Flag) []string {
+	seen := make(map[string]bool)
+	var patterns []string
+	for _, flag := range flags {
+		if group := flag.Group(); group != "" && !seen[group] {
+			seen[group] = true
+			patterns = append(patterns, group+".*")
+		}
+	}
+	return patterns
+}
+
+// lastWord returns the word being completed in line.
+func lastWord(line string) string {
+	if strings.HasSuffix(line, " ") {
+		return ""
+	}
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return ""
+	}
+	return words[len(words)-1]
+}
+
+func completeFiles(st store.Store, line string) []string {
+	dir, _ := filepath.Split(lastWord(line))
+	entries, err := os.ReadDir(filepath.Join(".", dir))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		name := dir + entry.Name()
+		if entry.IsDir() {
+			name += string(filepath.Separator)
+		}
+		names = append(names, name)
+	}
+	return names
+}
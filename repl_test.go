@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The single history file of earlier versions becomes the history of
+// every context.
+func TestHistoryFileMigratesOldFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	old := filepath.Join(home, ".gocli_history")
+	if err := os.WriteFile(old, []byte("add alice@example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := historyFile("admin"), filepath.Join(old, "admin"); got != want {
+		t.Fatalf("historyFile = %q, want %q", got, want)
+	}
+	for _, context := range []string{"admin", "flag"} {
+		history, err := os.ReadFile(filepath.Join(old, context))
+		if err != nil || string(history) != "add alice@example.com\n" {
+			t.Errorf("%s history = %q, %v; want the old history", context, history, err)
+		}
+	}
+	if _, err := os.Stat(old + ".old"); !os.IsNotExist(err) {
+		t.Errorf("backup of the old file left behind: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+
+	"github.com/qwerty-dvorak/gocli/cli"
+	"github.com/qwerty-dvorak/gocli/store"
+	"github.com/qwerty-dvorak/gocli/ui"
+)
+
+// printContextUsage prints the help of a context, generated from the
+// commands registered in it.
+func printContextUsage(ctx string) {
+	console.Printf("%sAvailable commands:%s\n", yellow, reset)
+	console.Printf("  Type %s'q'%s to exit\n", green, reset)
+	console.Printf("  Type %s'h'%s for help\n", green, reset)
+	console.Printf("  Type %s'use <context>'%s to switch to %s\n", green, reset, strings.Join(cli.Default.Contexts(), ", "))
+	for _, cmd := range cli.Default.Commands(ctx) {
+		console.Printf("  Type %s'%s'%s to %s\n", green, cli.Usage(cmd), reset, cmd.Help())
+	}
+	console.Printf("  Prefix a command with its context, e.g. %s'flag see'%s, to run it from any context\n", green, reset)
+}
+
+// dispatch runs a command line in ctx. A line starting with the name of
+// another context, such as "flag set x", runs the command there instead.
+// Errors are printed and returned.
+func dispatch(ctx string, line string, st store.Store) error {
+	start := time.Now()
+	err := runLine(ctx, line, st)
+	if err != nil {
+		slog.Info("command failed", "context", ctx, "command", line, "duration", time.Since(start), "error", err)
+	} else {
+		slog.Info("command", "context", ctx, "command", line, "duration", time.Since(start))
+	}
+	if errors.Is(err, ui.ErrCancelled) {
+		console.Printf("%sCancelled%s\n", yellow, reset)
+		return nil
+	}
+	if errors.As(err, &usageError{}) {
+		console.Printf("%sError: %v%s\n", red, err, reset)
+		printContextUsage(ctx)
+	} else if err != nil {
+		console.Printf("%sError %v%s\n", red, err, reset)
+	}
+	return err
+}
+
+func runLine(ctx string, line string, st store.Store) error {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return usageError{"empty command"}
+	}
+	_, cmd, args := cli.Default.Resolve(ctx, words)
+	if cmd == nil {
+		return usageError{"unknown command " + words[0]}
+	}
+	if err := cli.CheckArgs(cmd, args); err != nil {
+		return usageError{err.Error()}
+	}
+	return cmd.Run(st, args)
+}
+
+// runCommand runs a single command given on the command line, e.g.
+// "./main admin import admins.csv", and exits with the status of its
+// error if it fails. Like at the prompt, the command may be qualified
+// with another context, as in "./main admin users search ali".
+func runCommand(ctx string, args []string, st store.Store) {
+	if err := dispatch(ctx, strings.Join(args, " "), st); err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+// shell is the interactive prompt. It starts in one context and can move
+// between them with "use".
+type shell struct {
+	st      store.Store
+	current string
+	// rl is nil when stdin is not a terminal.
+	rl *readline.Instance
+}
+
+func runShell(ctx string, st store.Store) {
+	s := &shell{st: st, current: ctx}
+	if s.rl = newReadline(ctx, shellCompleter{s}); s.rl != nil {
+		console.SetLineReader(s.rl)
+		defer func() {
+			console.SetLineReader(nil)
+			s.rl.Close()
+		}()
+	}
+	s.switchTo(ctx)
+	printContextUsage(ctx)
+
+	for {
+		line, ok := readPromptLine()
+		if !ok {
+			break
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "exit", "quit", "q":
+			return
+		case "h", "help":
+			printContextUsage(s.current)
+			continue
+		case "use":
+			if len(words) != 2 || !cli.Default.HasContext(words[1]) {
+				console.Printf("%sError: use needs one of %s%s\n", red, strings.Join(cli.Default.Contexts(), ", "), reset)
+				continue
+			}
+			s.switchTo(words[1])
+			continue
+		}
+		if len(words) == 1 && cli.Default.HasContext(words[0]) {
+			s.switchTo(words[0])
+			continue
+		}
+		dispatch(s.current, line, st)
+	}
+}
+
+func (s *shell) switchTo(ctx string) {
+	s.current = ctx
+	console.SetPrompt(fmt.Sprintf("%s%s>%s ", blue, ctx, reset))
+	if s.rl != nil {
+		s.rl.SetHistoryPath(historyFile(ctx))
+	}
+}
+
+// completer builds the completion tree for the current context: its own
+// commands, "use", and every command qualified with its context name.
+func (s *shell) completer() *readline.PrefixCompleter {
+	items := []readline.PrefixCompleterInterface{
+		readline.PcItem("help"),
+		readline.PcItem("quit"),
+	}
+	use := readline.PcItem("use")
+	for _, ctx := range cli.Default.Contexts() {
+		use.Children = append(use.Children, readline.PcItem(ctx))
+		qualified := readline.PcItem(ctx, s.commandItems(ctx)...)
+		items = append(items, qualified)
+	}
+	items = append(items, use)
+	items = append(items, s.commandItems(s.current)...)
+	return readline.NewPrefixCompleter(items...)
+}
+
+func (s *shell) commandItems(ctx string) []readline.PrefixCompleterInterface {
+	var items []readline.PrefixCompleterInterface
+	for _, cmd := range cli.Default.Commands(ctx) {
+		item := readline.PcItem(cmd.Name())
+		if completer, ok := cmd.(cli.Completer); ok {
+			item.Children = append(item.Children, readline.PcItemDynamic(func(line string) []string {
+				return completer.Complete(s.st, line)
+			}))
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// shellCompleter rebuilds the completion tree on every tab press so it
+// follows context switches.
+type shellCompleter struct {
+	s *shell
+}
+
+func (c shellCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	return c.s.completer().Do(line, pos)
+}
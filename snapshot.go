@@ -0,0 +1,285 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qwerty-dvorak/gocli/mailaddr"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// snapshotVersion is bumped whenever the layout of Snapshot changes in a
+// way older versions of gocli cannot read. Version 1 kept only the value
+// of each flag, as a map of names to values; it can still be loaded.
+const snapshotVersion = 2
+
+// Snapshot is a copy of the admins, flags and whitelist of a database.
+// Users are referenced by email so a snapshot can be restored into a
+// database where the IDs differ.
+type Snapshot struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Admins    []AdminRecord     `json:"admins"`
+	Flags     []store.Flag      `json:"flags"`
+	Whitelist []WhitelistRecord `json:"whitelist"`
+}
+
+type WhitelistRecord struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func TakeSnapshot(st store.Store) (*Snapshot, error) {
+	admins, err := ListAdminRecords(st)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := st.ListFlags()
+	if err != nil {
+		return nil, err
+	}
+	whitelist, err := st.ListWhitelist()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Admins:    admins,
+		Flags:     flags,
+		Whitelist: make([]WhitelistRecord, len(whitelist)),
+	}
+	for i, entry := range whitelist {
+		snapshot.Whitelist[i] = WhitelistRecord{Name: entry.Name, Email: entry.Email}
+	}
+	return snapshot, nil
+}
+
+// SaveSnapshot writes snapshot to filename as json, gzipped when the name
+// ends in .gz.
+func SaveSnapshot(snapshot *Snapshot, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if !strings.HasSuffix(filename, ".gz") {
+		return encodeSnapshot(snapshot, file)
+	}
+	gz := gzip.NewWriter(file)
+	if err := encodeSnapshot(snapshot, gz); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func encodeSnapshot(snapshot *Snapshot, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+func LoadSnapshot(filename string) (*Snapshot, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	// Flags are decoded once the version says how they are laid out.
+	var decoded struct {
+		Snapshot
+		Flags json.RawMessage `json:"flags"`
+	}
+	if err := json.NewDecoder(in).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	snapshot := decoded.Snapshot
+	if snapshot.Version < 1 || snapshot.Version > snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	if err := decodeSnapshotFlags(&snapshot, decoded.Flags); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	for i := range snapshot.Admins {
+		snapshot.Admins[i].source = fmt.Sprintf("admin %d", i+1)
+	}
+	return &snapshot, nil
+}
+
+// describeFlag describes a flag being created, e.g. "true, owned by ops".
+func describeFlag(flag store.Flag) string {
+	detail := fmt.Sprintf("%t", flag.Value)
+	if flag.Owner != "" {
+		detail += ", owned by " + flag.Owner
+	}
+	return detail
+}
+
+// decodeSnapshotFlags reads the flags of a snapshot in the layout of its
+// version.
+func decodeSnapshotFlags(snapshot *Snapshot, data json.RawMessage) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if snapshot.Version > 1 {
+		return json.Unmarshal(data, &snapshot.Flags)
+	}
+	var values map[string]bool
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for name, value := range values {
+		snapshot.Flags = append(snapshot.Flags, store.Flag{Name: name, Value: value})
+	}
+	sort.Slice(snapshot.Flags, func(i, j int) bool {
+		return snapshot.Flags[i].Name < snapshot.Flags[j].Name
+	})
+	return nil
+}
+
+// RestoreSnapshot makes the admins, flags and whitelist of db match the
+// snapshot in a single transaction. Admins missing from the snapshot are
+// deleted and the whitelist is replaced. Flags missing from the database
+// are created with their description, owner and timestamps, so a snapshot
+// restores into a fresh one; flags that exist take the value, description
+// and owner of the snapshot; flags missing from the snapshot are left as
+// they are. Nothing is restored if an email of the whitelist is invalid.
+func RestoreSnapshot(snapshot *Snapshot, st store.Store) ([]stateChange, error) {
+	whitelist, err := snapshotWhitelist(snapshot.Whitelist)
+	if err != nil {
+		return nil, err
+	}
+	var changes []stateChange
+	err = st.Tx(func(tx store.Store) error {
+		flags, err := tx.ListFlags()
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]store.Flag, len(flags))
+		for _, flag := range flags {
+			existing[flag.Name] = flag
+		}
+		state := &State{Admins: snapshot.Admins, Flags: make(map[string]bool, len(snapshot.Flags))}
+		var flagChanges []stateChange
+		for _, flag := range snapshot.Flags {
+			current, ok := existing[flag.Name]
+			if !ok {
+				flagChanges = append(flagChanges, stateChange{"+", "flag " + flag.Name, describeFlag(flag), func(st store.Store) error {
+					return st.CreateFlag(flag)
+				}})
+				continue
+			}
+			state.Flags[flag.Name] = flag.Value
+			if current.Owner != flag.Owner || current.Description != flag.Description {
+				detail := fmt.Sprintf("owner %s -> %s, description %q -> %q", orDash(current.Owner), orDash(flag.Owner), current.Description, flag.Description)
+				flagChanges = append(flagChanges, stateChange{"~", "flag " + flag.Name, detail, func(st store.Store) error {
+					return st.DescribeFlag(flag.Name, flag.Owner, flag.Description)
+				}})
+			}
+		}
+
+		planned, err := PlanState(state, true, tx)
+		if err != nil {
+			return err
+		}
+		changes = append(planned, flagChanges...)
+		if err := applyChanges(changes, tx); err != nil {
+			return err
+		}
+
+		if err := tx.ClearWhitelist(); err != nil {
+			return err
+		}
+		for _, entry := range whitelist {
+			if user, err := findUser(entry.Email, tx); err == nil {
+				entry.UserID = user.ID
+			}
+			if err := tx.AddWhitelist(&entry); err != nil {
+				return fmt.Errorf("whitelist %s: %w", entry.Email, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// snapshotWhitelist normalizes the emails of the whitelist of a snapshot
+// the way an import does, and fails on every invalid or repeated one.
+func snapshotWhitelist(records []WhitelistRecord) ([]store.Whitelist, error) {
+	var errs []error
+	entries := make([]store.Whitelist, 0, len(records))
+	seen := make(map[string]bool, len(records))
+	for i, record := range records {
+		email, err := mailaddr.Normalize(record.Email)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("whitelist %d: %w", i+1, err))
+			continue
+		}
+		key := emailKey(email)
+		if seen[key] {
+			errs = append(errs, fmt.Errorf("whitelist %d: duplicate email %s", i+1, email))
+			continue
+		}
+		seen[key] = true
+		entries = append(entries, store.Whitelist{Name: record.Name, Email: email})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return entries, nil
+}
+
+func runSnapshot(args []string) {
+	if len(args) != 2 || (args[0] != "save" && args[0] != "restore") {
+		fail("", usageError{"snapshot needs save|restore and a file"})
+	}
+	action, filename := args[0], args[1]
+
+	if action == "save" {
+		st := connect()
+		snapshot, err := TakeSnapshot(st)
+		if err != nil {
+			fail("taking snapshot", err)
+		}
+		if err := SaveSnapshot(snapshot, filename); err != nil {
+			fail("writing snapshot", err)
+		}
+		console.Printf("%sSaved %d admins, %d flags and %d whitelist entries to %s%s\n",
+			green, len(snapshot.Admins), len(snapshot.Flags), len(snapshot.Whitelist), filename, reset)
+		return
+	}
+
+	snapshot, err := LoadSnapshot(filename)
+	if err != nil {
+		fail("reading snapshot", err)
+	}
+	st := connect()
+	changes, err := RestoreSnapshot(snapshot, st)
+	if err != nil {
+		fail("restoring snapshot", err)
+	}
+	printStateChanges(changes)
+	console.Printf("%sRestored snapshot from %s (%d whitelist entries)%s\n",
+		green, snapshot.CreatedAt.Format(time.RFC3339), len(snapshot.Whitelist), reset)
+}
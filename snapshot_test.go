@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// A snapshot restores into a database that lacks some of its flags by
+// creating them, and updates the flags that are already there.
+func TestRestoreSnapshotCreatesMissingFlags(t *testing.T) {
+	db, st := openTestDB(t)
+	addTestFlag(t, db, "registration", false)
+	addTestUser(t, db, "alice@example.com")
+
+	snapshot := &Snapshot{
+		Version: snapshotVersion,
+		Flags: []store.Flag{
+			{Name: "checkin.late", Value: false},
+			{Name: "checkin.open", Value: true, Owner: "ops"},
+			{Name: "registration", Value: true, Owner: "growth", Description: "Opens sign-ups"},
+		},
+		Whitelist: []WhitelistRecord{{Name: "Alice", Email: "alice@example.com"}},
+	}
+	changes, err := RestoreSnapshot(snapshot, st)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, fmt.Sprintf("%s %s (%s)", change.op, change.subject, change.detail))
+	}
+	want := []string{
+		"~ flag registration (false -> true)",
+		"+ flag checkin.late (false)",
+		"+ flag checkin.open (true, owned by ops)",
+		`~ flag registration (owner - -> growth, description "" -> "Opens sign-ups")`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+
+	flags, err := st.ListFlags()
+	if err != nil {
+		t.Fatalf("ListFlags: %v", err)
+	}
+	for i, flag := range flags {
+		flag.Base = store.Base{}
+		flags[i] = flag
+	}
+	if fmt.Sprint(flags) != fmt.Sprint(snapshot.Flags) {
+		t.Errorf("flags = %+v, want %+v", flags, snapshot.Flags)
+	}
+	entries, err := st.ListWhitelist()
+	if err != nil || len(entries) != 1 || entries[0].UserID == "" {
+		t.Errorf("whitelist = %+v, %v; want alice linked", entries, err)
+	}
+}
+
+// Saving a snapshot and restoring it into a fresh database keeps what
+// each flag is for, who owns it and when it was made.
+func TestSnapshotRoundTripKeepsFlagMetadata(t *testing.T) {
+	db, from := openTestDB(t)
+	addTestFlag(t, db, "checkin.open", true)
+	if err := from.DescribeFlag("checkin.open", "ops", "Lets people check in"); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	if _, err := db.Exec(`UPDATE flags SET created_at = $1`, created); err != nil {
+		t.Fatal(err)
+	}
+	want, err := from.ListFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := TakeSnapshot(from)
+	if err != nil {
+		t.Fatalf("TakeSnapshot: %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "snapshot.json.gz")
+	if err := SaveSnapshot(snapshot, filename); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if snapshot, err = LoadSnapshot(filename); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	_, to := openTestDB(t)
+	if _, err := RestoreSnapshot(snapshot, to); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+
+	got, err := to.ListFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("flags = %+v, want checkin.open", got)
+	}
+	flag := got[0]
+	if flag.Name != "checkin.open" || !flag.Value || flag.Owner != "ops" || flag.Description != "Lets people check in" {
+		t.Errorf("restored %+v, want checkin.open set, owned by ops and described", flag)
+	}
+	if !flag.CreatedAt.Equal(created) || !flag.UpdatedAt.Equal(want[0].UpdatedAt) {
+		t.Errorf("restored timestamps %v, %v; want %v, %v", flag.CreatedAt, flag.UpdatedAt, created, want[0].UpdatedAt)
+	}
+}
+
+// Snapshots from before flags had metadata still load.
+func TestLoadSnapshotVersion1(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "old.json")
+	data := `{"version": 1, "admins": [], "flags": {"registration": true, "checkin.open": false}, "whitelist": []}`
+	if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := LoadSnapshot(filename)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	want := []store.Flag{{Name: "checkin.open"}, {Name: "registration", Value: true}}
+	if fmt.Sprint(snapshot.Flags) != fmt.Sprint(want) {
+		t.Errorf("flags = %+v, want %+v", snapshot.Flags, want)
+	}
+}
+
+// Whitelist emails are normalized on restore, and an invalid one stops
+// the restore before anything is written.
+func TestRestoreSnapshotNormalizesWhitelist(t *testing.T) {
+	db, st := openTestDB(t)
+	user := addTestUser(t, db, "alice@example.com")
+	if err := st.AddWhitelist(&store.Whitelist{Name: "Carol", Email: "carol@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := &Snapshot{Version: snapshotVersion, Whitelist: []WhitelistRecord{
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Eve", Email: "eve@"},
+		{Name: "Bobby", Email: "BOB@example.com"},
+	}}
+	_, err := RestoreSnapshot(bad, st)
+	want := "whitelist 2: invalid email \"eve@\"\nwhitelist 3: duplicate email bob@example.com"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+	if entries, err := st.ListWhitelist(); err != nil || len(entries) != 1 || entries[0].Email != "carol@example.com" {
+		t.Errorf("whitelist = %+v, %v; want carol left alone", entries, err)
+	}
+
+	good := &Snapshot{Version: snapshotVersion, Whitelist: []WhitelistRecord{{Name: "Alice", Email: " Alice@Example.COM"}}}
+	if _, err := RestoreSnapshot(good, st); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	entries, err := st.ListWhitelist()
+	if err != nil || len(entries) != 1 || entries[0].Email != "alice@example.com" || entries[0].UserID != user.ID {
+		t.Errorf("whitelist = %+v, %v; want alice@example.com linked to %s", entries, err, user.ID)
+	}
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// whitelistBatchSize is how many entries are written between progress
+// reports, and per INSERT on SQLite.
+const whitelistBatchSize = 500
+
+// EntryError is the failure of a batch at one of its entries.
+type EntryError struct {
+	Entry Whitelist
+	Err   error
+}
+
+func (e *EntryError) Error() string {
+	return e.Entry.Email + ": " + e.Err.Error()
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// AddWhitelistBatch loads the entries into a temporary table, with COPY on
+// Postgres, and then adds them to whitelists in one statement that also
+// matches them to users. The database does not say which entry a bulk
+// statement failed on, so when it fails the entries are added again one
+// at a time to return an *EntryError for the first that fails.
+func (p *SQL) AddWhitelistBatch(entries []Whitelist, progress func(done int)) (int, error) {
+	entries = append([]Whitelist(nil), entries...)
+	for i := range entries {
+		if entries[i].ID == "" {
+			entries[i].ID = uuid.New().String()
+		}
+	}
+	if progress == nil {
+		progress = func(int) {}
+	}
+
+	linked := 0
+	err := p.tx(func(tx *SQL) error {
+		if _, err := tx.db.Exec(`SAVEPOINT whitelist_batch`); err != nil {
+			return wrapErr(err)
+		}
+		var err error
+		linked, err = tx.addWhitelistBatch(entries, progress)
+		if err == nil || errors.Is(err, ErrConnection) {
+			return err
+		}
+		if _, rollbackErr := tx.db.Exec(`ROLLBACK TO SAVEPOINT whitelist_batch`); rollbackErr != nil {
+			return err
+		}
+		return tx.findFailingEntry(entries, err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return linked, nil
+}
+
+// addWhitelistBatch is AddWhitelistBatch inside its transaction.
+func (p *SQL) addWhitelistBatch(entries []Whitelist, progress func(int)) (int, error) {
+	_, err := p.db.Exec(`CREATE TEMP TABLE whitelist_import AS
+		SELECT id, name, email, user_id FROM whitelists WHERE 1 = 0`)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	defer p.db.Exec(`DROP TABLE whitelist_import`)
+
+	load := p.insertWhitelistImport
+	if p.driver == DriverPostgres {
+		load = p.copyWhitelistImport
+	}
+	if err := load(entries, progress); err != nil {
+		return 0, err
+	}
+
+	_, err = p.db.Exec(`
+		INSERT INTO whitelists (id, name, email, user_id)
+		SELECT i.id, i.name, i.email, COALESCE(i.user_id, ` + userIDByEmail("i.email") + `)
+		FROM whitelist_import i`)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	linked := 0
+	err = p.db.QueryRow(`SELECT COUNT(*) FROM whitelists w
+		JOIN whitelist_import i ON i.id = w.id
+		WHERE w.user_id IS NOT NULL`).Scan(&linked)
+	return linked, wrapErr(err)
+}
+
+// findFailingEntry adds entries one at a time and returns an *EntryError
+// for the first that fails, or batchErr if none does.
+func (p *SQL) findFailingEntry(entries []Whitelist, batchErr error) error {
+	for _, entry := range entries {
+		_, err := p.db.Exec(`INSERT INTO whitelists (id, name, email, user_id)
+			VALUES ($1, $2, $3, COALESCE($4, `+userIDByEmail("$3")+`))`,
+			entry.ID, entry.Name, entry.Email, nullString(entry.UserID))
+		if err != nil {
+			return &EntryError{Entry: entry, Err: wrapErr(err)}
+		}
+	}
+	return batchErr
+}
+
+// copyWhitelistImport streams entries into whitelist_import with COPY.
+func (p *SQL) copyWhitelistImport(entries []Whitelist, progress func(int)) error {
+	stmt, err := p.db.Prepare(pq.CopyIn("whitelist_import", "id", "name", "email", "user_id"))
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer stmt.Close()
+	for i, entry := range entries {
+		if _, err := stmt.Exec(entry.ID, entry.Name, entry.Email, nullString(entry.UserID)); err != nil {
+			return wrapErr(err)
+		}
+		if (i+1)%whitelistBatchSize == 0 {
+			progress(i + 1)
+		}
+	}
+	// Exec without arguments flushes the rows still buffered.
+	if _, err := stmt.Exec(); err != nil {
+		return wrapErr(err)
+	}
+	progress(len(entries))
+	return wrapErr(stmt.Close())
+}
+
+// insertWhitelistImport fills whitelist_import with multi-row INSERTs, for
+// databases without COPY.
+func (p *SQL) insertWhitelistImport(entries []Whitelist, progress func(int)) error {
+	for start := 0; start < len(entries); start += whitelistBatchSize {
+		batch := entries[start:min(start+whitelistBatchSize, len(entries))]
+		values := make([]string, len(batch))
+		args := make([]any, 0, 4*len(batch))
+		for i, entry := range batch {
+			n := 4 * i
+			values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+			args = append(args, entry.ID, entry.Name, entry.Email, nullString(entry.UserID))
+		}
+		_, err := p.db.Exec(`INSERT INTO whitelist_import (id, name, email, user_id) VALUES `+
+			strings.Join(values, ", "), args...)
+		if err != nil {
+			return wrapErr(err)
+		}
+		progress(start + len(batch))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testBackends open an empty database for each driver the batch is
+// written for: Postgres loads it with COPY, SQLite with multi-row INSERTs.
+var testBackends = map[string]func(t *testing.T) (*sql.DB, *SQL){
+	DriverPostgres: openTestPostgres,
+}
+
+// openTestPostgres returns a throwaway schema of TEST_DATABASE_URL, and
+// skips the test without one.
+func openTestPostgres(t *testing.T) (*sql.DB, *SQL) {
+	t.Helper()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("set TEST_DATABASE_URL to test on Postgres")
+	}
+	admin, err := sql.Open(DriverPostgres, databaseURL)
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	name := "gocli_store_test_" + uuid.New().String()[:8]
+	if _, err := admin.Exec("CREATE SCHEMA " + name); err != nil {
+		admin.Close()
+		t.Fatalf("creating test schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + name + " CASCADE")
+		admin.Close()
+	})
+
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatalf("the test database must have a URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", name)
+	u.RawQuery = query.Encode()
+	db, err := sql.Open(DriverPostgres, u.String())
+	if err != nil {
+		t.Fatalf("opening test schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := CreateSchema(db, DriverPostgres); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	return db, NewPostgres(db)
+}
+
+// forEachBackend runs test as a subtest on each of testBackends.
+func forEachBackend(t *testing.T, test func(t *testing.T, db *sql.DB, p *SQL)) {
+	for driver, open := range testBackends {
+		t.Run(driver, func(t *testing.T) {
+			db, p := open(t)
+			test(t, db, p)
+		})
+	}
+}
+
+func TestAddWhitelistBatch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, p *SQL) {
+		var entries []Whitelist
+		for i := 0; i < 1234; i++ {
+			email := fmt.Sprintf("person%d@example.com", i)
+			if i%100 == 0 {
+				if _, err := p.db.Exec(`INSERT INTO users (id, email, name) VALUES ($1, $2, $3)`,
+					uuid.New().String(), strings.ToUpper(email), email); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entries = append(entries, Whitelist{Name: fmt.Sprintf("Person %d", i), Email: email})
+		}
+
+		var progress []int
+		linked, err := p.AddWhitelistBatch(entries, func(done int) { progress = append(progress, done) })
+		if err != nil {
+			t.Fatalf("AddWhitelistBatch: %v", err)
+		}
+		if linked != 13 {
+			t.Errorf("linked %d entries, want 13", linked)
+		}
+		if fmt.Sprint(progress) != "[500 1000 1234]" {
+			t.Errorf("progress = %v, want [500 1000 1234]", progress)
+		}
+		whitelist, err := p.ListWhitelist()
+		if err != nil || len(whitelist) != len(entries) {
+			t.Errorf("%d entries whitelisted, %v; want %d", len(whitelist), err, len(entries))
+		}
+	})
+}
+
+// A batch that fails names the entry it failed on and adds nothing.
+func TestAddWhitelistBatchEntryError(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, p *SQL) {
+		if _, err := db.Exec(`CREATE UNIQUE INDEX whitelists_email ON whitelists (email)`); err != nil {
+			t.Fatal(err)
+		}
+		entries := []Whitelist{
+			{Name: "Alice", Email: "alice@example.com"},
+			{Name: "Bob", Email: "bob@example.com"},
+			{Name: "Alice again", Email: "alice@example.com"},
+		}
+
+		_, err := p.AddWhitelistBatch(entries, nil)
+		var entryErr *EntryError
+		if !errors.As(err, &entryErr) || entryErr.Entry.Name != "Alice again" {
+			t.Fatalf("got %v, want an *EntryError for Alice again", err)
+		}
+		if ErrorCode(err) != CodeDuplicate || !errors.Is(err, ErrConstraint) {
+			t.Errorf("got code %d, want CodeDuplicate", ErrorCode(err))
+		}
+		if whitelist, err := p.ListWhitelist(); err != nil || len(whitelist) != 0 {
+			t.Errorf("whitelist = %+v, %v; want nothing added", whitelist, err)
+		}
+	})
+}
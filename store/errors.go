@@ -0,0 +1,150 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// Code classifies the errors of the data layer. Codes are stable, so
+// callers can map them to messages and exit statuses: each has an explicit
+// value, and new codes take the next unused one.
+type Code int
+
+const (
+	CodeUnknown       Code = 0
+	CodeUserNotFound  Code = 1
+	CodeAdminNotFound Code = 2
+	CodeAdminExists   Code = 3
+	CodeFlagNotFound  Code = 4
+	CodeConstraint    Code = 5
+	CodeScan          Code = 6
+	// The constraint violations that have codes of their own.
+	CodeDuplicate    Code = 7
+	CodeReference    Code = 8
+	CodeMissingValue Code = 9
+
+	CodeConnection     Code = 10
+	CodeSchemaOutdated Code = 11
+)
+
+var codeMessages = map[Code]string{
+	CodeUnknown:        "database error",
+	CodeUserNotFound:   "user not found",
+	CodeAdminNotFound:  "admin not found",
+	CodeAdminExists:    "admin already exists",
+	CodeFlagNotFound:   "flag not found",
+	CodeConstraint:     "constraint violation",
+	CodeScan:           "error scanning row",
+	CodeDuplicate:      "duplicate value",
+	CodeReference:      "reference to a missing row",
+	CodeMissingValue:   "missing required value",
+	CodeConnection:     "database connection failed",
+	CodeSchemaOutdated: "database schema is out of date",
+}
+
+// IsConstraint reports whether c is a constraint violation.
+func (c Code) IsConstraint() bool {
+	return c == CodeConstraint || c == CodeDuplicate || c == CodeReference || c == CodeMissingValue
+}
+
+// Error is an error of the data layer with its code and, when there is
+// one, the underlying error. errors.Is matches it against the sentinel of
+// the same code as well as against its cause; every constraint violation
+// matches ErrConstraint.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return codeMessages[e.Code]
+	}
+	return codeMessages[e.Code] + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || t.Err != nil {
+		return false
+	}
+	return t.Code == e.Code || t.Code == CodeConstraint && e.Code.IsConstraint()
+}
+
+var (
+	ErrUserNotFound  = &Error{Code: CodeUserNotFound}
+	ErrAdminNotFound = &Error{Code: CodeAdminNotFound}
+	ErrAdminExists   = &Error{Code: CodeAdminExists}
+	ErrFlagNotFound  = &Error{Code: CodeFlagNotFound}
+	ErrConstraint    = &Error{Code: CodeConstraint}
+	ErrScanRow       = &Error{Code: CodeScan}
+	ErrConnection    = &Error{Code: CodeConnection}
+)
+
+// pqCodes are the Postgres error codes with a Code of their own.
+var pqCodes = map[pq.ErrorCode]Code{
+	"23505": CodeDuplicate,    // unique_violation
+	"23503": CodeReference,    // foreign_key_violation
+	"23502": CodeMissingValue, // not_null_violation
+}
+
+// ErrorCode returns the code of err, or CodeUnknown if it does not come
+// from the data layer.
+func ErrorCode(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// wrapErr classifies an error returned by a database driver, keeping it
+// as the cause.
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if code, ok := pqCodes[pqErr.Code]; ok {
+			return &Error{Code: code, Err: err}
+		}
+		switch pqErr.Code.Class() {
+		case "23":
+			return &Error{Code: CodeConstraint, Err: err}
+		case "08", "57": // connection_exception, operator_intervention
+			return &Error{Code: CodeConnection, Err: err}
+		}
+		return err
+	}
+	if code, ok := sqliteErrorCode(err); ok {
+		return &Error{Code: code, Err: err}
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return &Error{Code: CodeConnection, Err: err}
+	}
+	return err
+}
+
+// wrapScanErr is wrapErr for the error of a Scan, where sql.ErrNoRows
+// means the row was not found and is reported as notFound.
+func wrapScanErr(err error, notFound *Error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	err = wrapErr(err)
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Code: CodeScan, Err: err}
+}
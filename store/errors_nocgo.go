@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package store
+
+// sqliteErrorCode never classifies anything in builds without cgo, which
+// cannot open SQLite databases at all.
+func sqliteErrorCode(err error) (Code, bool) {
+	return CodeUnknown, false
+}
@@ -0,0 +1,30 @@
+//go:build cgo
+
+package store
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteCodes are the SQLite extended error codes with a Code of their
+// own.
+var sqliteCodes = map[sqlite3.ErrNoExtended]Code{
+	sqlite3.ErrConstraintUnique:     CodeDuplicate,
+	sqlite3.ErrConstraintPrimaryKey: CodeDuplicate,
+	sqlite3.ErrConstraintForeignKey: CodeReference,
+	sqlite3.ErrConstraintNotNull:    CodeMissingValue,
+}
+
+// sqliteErrorCode classifies a constraint violation reported by SQLite.
+func sqliteErrorCode(err error) (Code, bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return CodeUnknown, false
+	}
+	if code, ok := sqliteCodes[sqliteErr.ExtendedCode]; ok {
+		return code, true
+	}
+	return CodeConstraint, true
+}
@@ -0,0 +1,27 @@
+//go:build cgo
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestWrapErrSQLite(t *testing.T) {
+	for _, test := range []struct {
+		err  sqlite3.Error
+		code Code
+	}{
+		{sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, CodeDuplicate},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, CodeDuplicate},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintForeignKey}, CodeReference},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintNotNull}, CodeMissingValue},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintCheck}, CodeConstraint},
+		{sqlite3.Error{Code: sqlite3.ErrBusy}, CodeUnknown},
+	} {
+		if code := ErrorCode(wrapErr(test.err)); code != test.code {
+			t.Errorf("%v (%d): code %d, want %d", test.err, test.err.ExtendedCode, code, test.code)
+		}
+	}
+}
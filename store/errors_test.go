@@ -0,0 +1,57 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestWrapErr(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for _, test := range []struct {
+		name string
+		err  error
+		code Code
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, CodeDuplicate},
+		{"foreign key violation", &pq.Error{Code: "23503"}, CodeReference},
+		{"not null violation", &pq.Error{Code: "23502"}, CodeMissingValue},
+		{"check violation", &pq.Error{Code: "23514"}, CodeConstraint},
+		{"connection failure", &pq.Error{Code: "08006"}, CodeConnection},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, CodeConnection},
+		{"bad connection", driver.ErrBadConn, CodeConnection},
+		{"network error", netErr, CodeConnection},
+	} {
+		err := wrapErr(test.err)
+		if ErrorCode(err) != test.code || !errors.Is(err, test.err) {
+			t.Errorf("%s: wrapErr = %v with code %d, want code %d wrapping the cause", test.name, err, ErrorCode(err), test.code)
+		}
+		if errors.Is(err, ErrConstraint) != test.code.IsConstraint() {
+			t.Errorf("%s: errors.Is(%v, ErrConstraint) = %t", test.name, err, !test.code.IsConstraint())
+		}
+	}
+
+	// Errors that are not classified are returned as they are.
+	for _, err := range []error{nil, &pq.Error{Code: "42P01"}, errors.New("boom")} {
+		if got := wrapErr(err); got != err {
+			t.Errorf("wrapErr(%v) = %v, want it unchanged", err, got)
+		}
+	}
+}
+
+func TestWrapScanErr(t *testing.T) {
+	if err := wrapScanErr(sql.ErrNoRows, ErrUserNotFound); err != ErrUserNotFound {
+		t.Errorf("no rows: got %v, want ErrUserNotFound", err)
+	}
+	if err := wrapScanErr(&pq.Error{Code: "23505"}, ErrUserNotFound); ErrorCode(err) != CodeDuplicate {
+		t.Errorf("unique violation: got %v, want CodeDuplicate", err)
+	}
+	cause := errors.New("converting column")
+	if err := wrapScanErr(cause, ErrUserNotFound); !errors.Is(err, ErrScanRow) || !errors.Is(err, cause) {
+		t.Errorf("other errors: got %v, want ErrScanRow wrapping the cause", err)
+	}
+}
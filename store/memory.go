@@ -0,0 +1,475 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"github.com/qwerty-dvorak/gocli/mailaddr"
+)
+
+// Memory is a Store that keeps everything in memory, for tests and
+// offline demos. The zero value is not usable; use NewMemory or
+// LoadFixture.
+type Memory struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+type memoryData struct {
+	users     map[string]User  // by id
+	admins    map[string]Admin // by user id
+	flags     map[string]Flag  // by name
+	whitelist []Whitelist
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		users:  make(map[string]User),
+		admins: make(map[string]Admin),
+		flags:  make(map[string]Flag),
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := newMemoryData()
+	for id, user := range d.users {
+		c.users[id] = user
+	}
+	for id, admin := range d.admins {
+		c.admins[id] = admin
+	}
+	for name, flag := range d.flags {
+		c.flags[name] = flag
+	}
+	c.whitelist = append([]Whitelist(nil), d.whitelist...)
+	return c
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: newMemoryData()}
+}
+
+// Fixture is the seed data of a Memory store, read from yaml or json.
+type Fixture struct {
+	Users []struct {
+		Email string `yaml:"email"`
+		Name  string `yaml:"name"`
+	} `yaml:"users"`
+	Admins []struct {
+		Email                    string `yaml:"email"`
+		CheckinAccess            bool   `yaml:"checkin_access"`
+		AnticheatAccess          bool   `yaml:"anticheat_access"`
+		QrmgmtAccess             bool   `yaml:"qrmgmt_access"`
+		QuestionManagementAccess bool   `yaml:"question_management_access"`
+		CommunicationAccess      bool   `yaml:"communication_access"`
+	} `yaml:"admins"`
+	Flags     FixtureFlags `yaml:"flags"`
+	Whitelist []struct {
+		Name  string `yaml:"name"`
+		Email string `yaml:"email"`
+	} `yaml:"whitelist"`
+}
+
+// FixtureFlags are the flags of a fixture: a list of flags with their
+// metadata, or a mapping of names to values as in older fixtures.
+type FixtureFlags []Flag
+
+func (f *FixtureFlags) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return node.Decode((*[]Flag)(f))
+	}
+	var values map[string]bool
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*f = nil
+	for name, value := range values {
+		*f = append(*f, Flag{Name: name, Value: value})
+	}
+	sort.Slice(*f, func(i, j int) bool {
+		return (*f)[i].Name < (*f)[j].Name
+	})
+	return nil
+}
+
+// LoadFixture returns a Memory store seeded from a yaml or json fixture
+// file. Admins and whitelist entries refer to users by email. Emails are
+// normalized, and an invalid or repeated one is an error.
+func LoadFixture(filename string) (*Memory, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := yaml.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture: %w", err)
+	}
+
+	m := NewMemory()
+	users := make(map[string]bool, len(fixture.Users))
+	for i, u := range fixture.Users {
+		email, err := fixtureEmail("user", i, u.Email, users)
+		if err != nil {
+			return nil, err
+		}
+		m.AddUser(User{Base: NewBase(), Email: email, Name: u.Name})
+	}
+	admins := make(map[string]bool, len(fixture.Admins))
+	for i, a := range fixture.Admins {
+		email, err := fixtureEmail("admin", i, a.Email, admins)
+		if err != nil {
+			return nil, err
+		}
+		user, err := m.GetUserByEmail(email)
+		if err != nil {
+			return nil, fmt.Errorf("fixture admin %s: %w", email, err)
+		}
+		admin := NewAdmin(*user)
+		admin.CheckinAccess = a.CheckinAccess
+		admin.AnticheatAccess = a.AnticheatAccess
+		admin.QrmgmtAccess = a.QrmgmtAccess
+		admin.QuestionManagementAccess = a.QuestionManagementAccess
+		admin.CommunicationAccess = a.CommunicationAccess
+		if err := m.CreateAdmin(&admin); err != nil {
+			return nil, fmt.Errorf("fixture admin %s: %w", email, err)
+		}
+	}
+	for _, flag := range fixture.Flags {
+		if err := m.CreateFlag(flag); err != nil {
+			return nil, fmt.Errorf("fixture flag %s: %w", flag.Name, err)
+		}
+	}
+	whitelisted := make(map[string]bool, len(fixture.Whitelist))
+	for i, w := range fixture.Whitelist {
+		email, err := fixtureEmail("whitelist entry", i, w.Email, whitelisted)
+		if err != nil {
+			return nil, err
+		}
+		entry := Whitelist{Name: w.Name, Email: email}
+		if user, err := m.GetUserByEmail(email); err == nil {
+			entry.UserID = user.ID
+		}
+		if err := m.AddWhitelist(&entry); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// fixtureEmail normalizes the email of the i-th record of a kind in a
+// fixture and checks that no earlier record in seen has it.
+func fixtureEmail(kind string, i int, address string, seen map[string]bool) (string, error) {
+	email, err := mailaddr.Normalize(address)
+	if err != nil {
+		return "", fmt.Errorf("fixture %s %d: %w", kind, i+1, err)
+	}
+	if seen[email] {
+		return "", fmt.Errorf("fixture %s %d: duplicate email %s", kind, i+1, email)
+	}
+	seen[email] = true
+	return email, nil
+}
+
+// AddUser adds a user, which the Store interface cannot do since users
+// register through the main application.
+func (m *Memory) AddUser(user User) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user.ID == "" {
+		user.Base = NewBase()
+	}
+	m.data.users[user.ID] = user
+}
+
+// Tx runs fn against a copy of the data and keeps the copy only if fn
+// succeeds.
+func (m *Memory) Tx(fn func(Store) error) error {
+	m.mu.Lock()
+	tx := &Memory{data: m.data.clone()}
+	m.mu.Unlock()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.data = tx.data
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) GetUserByEmail(email string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.data.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *Memory) UserEmails(prefix string, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var emails []string
+	prefix = strings.ToLower(prefix)
+	for _, user := range m.data.users {
+		if strings.HasPrefix(strings.ToLower(user.Email), prefix) {
+			emails = append(emails, user.Email)
+		}
+	}
+	sort.Strings(emails)
+	if len(emails) > limit {
+		emails = emails[:limit]
+	}
+	return emails, nil
+}
+
+func (m *Memory) UserCandidates(term string, maxTypos int) ([]User, error) {
+	term = strings.ToLower(term)
+	n := utf8.RuneCountInString(term)
+	near := func(s string) bool {
+		l := utf8.RuneCountInString(s)
+		return l >= n-maxTypos && l <= n+maxTypos
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []User
+	for _, user := range m.data.users {
+		local, _, _ := strings.Cut(user.Email, "@")
+		if hasInOrder(strings.ToLower(user.Email), term) || hasInOrder(strings.ToLower(user.Name), term) ||
+			near(user.Email) || near(user.Name) || near(local) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+	return users, nil
+}
+
+// hasInOrder reports whether s holds the letters of term in order.
+func hasInOrder(s, term string) bool {
+	rest := []rune(term)
+	for _, r := range s {
+		if len(rest) > 0 && r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+func (m *Memory) ListUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := make([]User, 0, len(m.data.users))
+	for _, user := range m.data.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+	return users, nil
+}
+
+func (m *Memory) GetAdmin(userID string) (*Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	admin, ok := m.data.admins[userID]
+	if !ok {
+		return nil, ErrAdminNotFound
+	}
+	return &admin, nil
+}
+
+func (m *Memory) CreateAdmin(admin *Admin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data.admins[admin.UserID]; ok {
+		return ErrAdminExists
+	}
+	user, ok := m.data.users[admin.UserID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	admin.User = user
+	m.data.admins[admin.UserID] = *admin
+	return nil
+}
+
+func (m *Memory) UpdateAdmin(admin *Admin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.data.admins[admin.UserID]
+	if !ok {
+		return ErrAdminNotFound
+	}
+	admin.UpdatedAt = time.Now()
+	existing.CheckinAccess = admin.CheckinAccess
+	existing.AnticheatAccess = admin.AnticheatAccess
+	existing.QrmgmtAccess = admin.QrmgmtAccess
+	existing.QuestionManagementAccess = admin.QuestionManagementAccess
+	existing.CommunicationAccess = admin.CommunicationAccess
+	existing.UpdatedAt = admin.UpdatedAt
+	m.data.admins[admin.UserID] = existing
+	return nil
+}
+
+func (m *Memory) DeleteAdmin(adminID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for userID, admin := range m.data.admins {
+		if admin.ID == adminID {
+			delete(m.data.admins, userID)
+			return nil
+		}
+	}
+	return ErrAdminNotFound
+}
+
+func (m *Memory) ListAdmins() ([]Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	admins := make([]Admin, 0, len(m.data.admins))
+	for userID, admin := range m.data.admins {
+		admin.User = m.data.users[userID]
+		admins = append(admins, admin)
+	}
+	sort.Slice(admins, func(i, j int) bool {
+		return admins[i].User.Email < admins[j].User.Email
+	})
+	return admins, nil
+}
+
+func (m *Memory) ListFlags() ([]Flag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flags := make([]Flag, 0, len(m.data.flags))
+	for _, flag := range m.data.flags {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags, nil
+}
+
+func (m *Memory) CreateFlag(flag Flag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data.flags[flag.Name]; ok {
+		return &Error{Code: CodeDuplicate, Err: fmt.Errorf("flag %s exists", flag.Name)}
+	}
+	flag.ID = ""
+	m.data.flags[flag.Name] = flag
+	return nil
+}
+
+func (m *Memory) SetFlag(name string, value bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flag, ok := m.data.flags[name]
+	if !ok {
+		return ErrFlagNotFound
+	}
+	flag.Value = value
+	flag.UpdatedAt = time.Now()
+	m.data.flags[name] = flag
+	return nil
+}
+
+func (m *Memory) DescribeFlag(name, owner, description string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flag, ok := m.data.flags[name]
+	if !ok {
+		return ErrFlagNotFound
+	}
+	flag.Owner, flag.Description = owner, description
+	flag.UpdatedAt = time.Now()
+	m.data.flags[name] = flag
+	return nil
+}
+
+func (m *Memory) ListWhitelist() ([]Whitelist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := append([]Whitelist(nil), m.data.whitelist...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Email < entries[j].Email
+	})
+	return entries, nil
+}
+
+func (m *Memory) AddWhitelist(entry *Whitelist) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	m.data.whitelist = append(m.data.whitelist, *entry)
+	return nil
+}
+
+func (m *Memory) AddWhitelistBatch(entries []Whitelist, progress func(done int)) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userIDs := m.userIDsByEmail()
+	linked := 0
+	for i, entry := range entries {
+		if entry.ID == "" {
+			entry.ID = uuid.New().String()
+		}
+		if entry.UserID == "" {
+			entry.UserID = userIDs[strings.ToLower(entry.Email)]
+		}
+		if entry.UserID != "" {
+			linked++
+		}
+		m.data.whitelist = append(m.data.whitelist, entry)
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return linked, nil
+}
+
+func (m *Memory) LinkWhitelist() ([]Whitelist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userIDs := m.userIDsByEmail()
+	var linked []Whitelist
+	for i, entry := range m.data.whitelist {
+		if userID := userIDs[strings.ToLower(entry.Email)]; entry.UserID == "" && userID != "" {
+			m.data.whitelist[i].UserID = userID
+			linked = append(linked, m.data.whitelist[i])
+		}
+	}
+	sort.SliceStable(linked, func(i, j int) bool {
+		return linked[i].Email < linked[j].Email
+	})
+	return linked, nil
+}
+
+// userIDsByEmail maps lowercased emails to user IDs. m.mu must be held.
+func (m *Memory) userIDsByEmail() map[string]string {
+	userIDs := make(map[string]string, len(m.data.users))
+	for _, user := range m.data.users {
+		userIDs[strings.ToLower(user.Email)] = user.ID
+	}
+	return userIDs
+}
+
+func (m *Memory) ClearWhitelist() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data.whitelist = nil
+	return nil
+}
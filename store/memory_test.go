@@ -0,0 +1,79 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFixture(t *testing.T, data string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "fixture.yaml")
+	if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// Fixture emails are normalized, so admins and whitelist entries find
+// their users however they are written.
+func TestLoadFixtureNormalizesEmails(t *testing.T) {
+	m, err := LoadFixture(writeFixture(t, `
+users:
+  - email: " Alice@Example.com"
+    name: Alice
+admins:
+  - email: ALICE@example.com
+    checkin_access: true
+whitelist:
+  - name: Alice
+    email: alice@EXAMPLE.com
+`))
+	if err != nil {
+		t.Fatalf("LoadFixture: %v", err)
+	}
+	user, err := m.GetUserByEmail("alice@example.com")
+	if err != nil || user.Email != "alice@example.com" {
+		t.Fatalf("user = %+v, %v; want alice@example.com", user, err)
+	}
+	if admin, err := m.GetAdmin(user.ID); err != nil || !admin.CheckinAccess {
+		t.Errorf("admin = %+v, %v; want alice with checkin access", admin, err)
+	}
+	entries, err := m.ListWhitelist()
+	if err != nil || len(entries) != 1 || entries[0].Email != "alice@example.com" || entries[0].UserID != user.ID {
+		t.Errorf("whitelist = %+v, %v; want alice@example.com linked", entries, err)
+	}
+}
+
+func TestLoadFixtureRejectsBadEmails(t *testing.T) {
+	for _, test := range []struct {
+		fixture, want string
+	}{
+		{"users:\n  - email: alice at example.com\n", `fixture user 1: invalid email "alice at example.com"`},
+		{"users:\n  - email: a@example.com\n  - email: A@example.com\n", "fixture user 2: duplicate email a@example.com"},
+		{"whitelist:\n  - email: \"\"\n", "fixture whitelist entry 1: missing email"},
+	} {
+		_, err := LoadFixture(writeFixture(t, test.fixture))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: got %v, want %s", test.fixture, err, test.want)
+		}
+	}
+}
+
+// Flags are a list with their metadata, or a mapping of names to values
+// as in older fixtures.
+func TestLoadFixtureFlags(t *testing.T) {
+	for _, fixture := range []string{
+		"flags:\n  registration: true\n  checkin.open: false\n",
+		"flags:\n  - name: checkin.open\n    owner: ops\n    created_at: 2026-03-01T09:30:00Z\n  - name: registration\n    value: true\n",
+	} {
+		m, err := LoadFixture(writeFixture(t, fixture))
+		if err != nil {
+			t.Fatalf("LoadFixture: %v", err)
+		}
+		flags, err := m.ListFlags()
+		if err != nil || len(flags) != 2 || flags[0].Name != "checkin.open" || flags[0].Value || flags[1].Name != "registration" || !flags[1].Value {
+			t.Errorf("%q: flags = %+v, %v", fixture, flags, err)
+		}
+	}
+}
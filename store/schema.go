@@ -0,0 +1,151 @@
+package store
+
+import "database/sql"
+
+// schema creates the tables gocli uses. It is written to run on both
+// Postgres and SQLite.
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS admins (
+	id TEXT PRIMARY KEY,
+	checkin_access BOOLEAN NOT NULL DEFAULT FALSE,
+	anticheat_access BOOLEAN NOT NULL DEFAULT FALSE,
+	qrmgmt_access BOOLEAN NOT NULL DEFAULT FALSE,
+	question_management_access BOOLEAN NOT NULL DEFAULT FALSE,
+	communication_access BOOLEAN NOT NULL DEFAULT FALSE,
+	user_id TEXT NOT NULL UNIQUE REFERENCES users (id),
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS qr_data (
+	id TEXT PRIMARY KEY,
+	admin_id TEXT NOT NULL REFERENCES admins (id)
+);
+CREATE TABLE IF NOT EXISTS flags (
+	name TEXT PRIMARY KEY,
+	value BOOLEAN NOT NULL DEFAULT FALSE,
+	description TEXT NOT NULL DEFAULT '',
+	owner TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS whitelists (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	user_id TEXT REFERENCES users (id)
+);
+`
+
+// flagColumns are the columns gocli added to the flags table after it was
+// first created, with their definitions. Unlike in schema the timestamps
+// have no default, which would date every existing flag to the migration.
+var flagColumns = [][2]string{
+	{"description", "TEXT NOT NULL DEFAULT ''"},
+	{"owner", "TEXT NOT NULL DEFAULT ''"},
+	{"created_at", "TIMESTAMP"},
+	{"updated_at", "TIMESTAMP"},
+}
+
+// emailIndexes create the index that lets users be looked up, and emails
+// completed, ignoring case. On Postgres text_pattern_ops makes it serve
+// LIKE prefixes as well as equality whatever the collation.
+var emailIndexes = map[string]string{
+	DriverPostgres: `CREATE INDEX IF NOT EXISTS users_email_lower ON users (LOWER(email) text_pattern_ops)`,
+	DriverSQLite:   `CREATE INDEX IF NOT EXISTS users_email_lower ON users (LOWER(email))`,
+}
+
+// CreateSchema creates any missing tables and the users_email_lower
+// index, for databases that have not been set up by the main application
+// such as a local SQLite file or a test database. Tables that already
+// exist are left as they are, to be brought up to date by Migrate.
+func CreateSchema(db *sql.DB, driver string) error {
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	_, err := db.Exec(emailIndexes[driver])
+	return err
+}
+
+// Migrate adds the columns gocli needs to tables that predate them, such
+// as the flag metadata, and the users_email_lower index, and returns what
+// it changed. It only ever adds, but to tables the main application owns,
+// so it runs when asked to with "./main migrate" and never on connecting.
+// An application that manages its own schema needs the same columns and
+// an index on LOWER(email).
+func Migrate(db *sql.DB, driver string) ([]string, error) {
+	existing, err := columnsOf(db, "flags")
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	var changes []string
+	for _, column := range flagColumns {
+		if existing[column[0]] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE flags ADD COLUMN ` + column[0] + ` ` + column[1]); err != nil {
+			return changes, wrapErr(err)
+		}
+		changes = append(changes, "added column flags."+column[0])
+	}
+
+	exists, err := indexExists(db, driver, "users_email_lower")
+	if err != nil {
+		return changes, wrapErr(err)
+	}
+	if !exists {
+		if _, err := db.Exec(emailIndexes[driver]); err != nil {
+			return changes, wrapErr(err)
+		}
+		changes = append(changes, "added index users_email_lower")
+	}
+	return changes, nil
+}
+
+// indexExists reports whether the database has an index named name.
+func indexExists(db *sql.DB, driver, name string) (bool, error) {
+	query := `SELECT COUNT(*) FROM pg_indexes WHERE schemaname = current_schema() AND indexname = $1`
+	if driver == DriverSQLite {
+		query = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`
+	}
+	var count int
+	err := db.QueryRow(query, name).Scan(&count)
+	return count > 0, err
+}
+
+// hasFlagMetadata reports whether the flags table has every column in
+// flagColumns, which it lacks until migrated.
+func hasFlagMetadata(q querier) (bool, error) {
+	existing, err := columnsOf(q, "flags")
+	if err != nil {
+		return false, err
+	}
+	for _, column := range flagColumns {
+		if !existing[column[0]] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// columnsOf returns the set of columns of table.
+func columnsOf(q querier, table string) (map[string]bool, error) {
+	rows, err := q.Query(`SELECT * FROM ` + table + ` WHERE 1 = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column] = true
+	}
+	return existing, nil
+}
@@ -0,0 +1,456 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// likeEscaper escapes the wildcards of LIKE, for patterns with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// querier is the subset of *sql.DB that is also implemented by *sql.Tx, so
+// the same queries run inside or outside a transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// Drivers supported by Open, as named by database/sql.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// SQL is the Store backed by the gocli schema in a SQL database. Queries
+// are written for Postgres and rewritten for other dialects.
+type SQL struct {
+	db     querier
+	driver string
+	// conn is nil for the Store passed to a Tx callback.
+	conn *sql.DB
+	// flagMetadata is false for a flags table that has not been migrated
+	// to have descriptions, owners and timestamps yet.
+	flagMetadata bool
+}
+
+// Open returns the Store for a database opened with driver, creating the
+// tables first where the database is local to gocli (SQLite). Existing
+// tables are never altered here; until "./main migrate" is run on a
+// database that predates the flag metadata, flags are read and set
+// without it.
+func Open(db *sql.DB, driver string) (*SQL, error) {
+	var p *SQL
+	switch driver {
+	case DriverPostgres:
+		p = NewPostgres(db)
+	case DriverSQLite:
+		var err error
+		if p, err = NewSQLite(db); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	metadata, err := hasFlagMetadata(p.db)
+	if err != nil {
+		return nil, fmt.Errorf("reading the flags table: %w", wrapErr(err))
+	}
+	p.flagMetadata = metadata
+	return p, nil
+}
+
+// NewPostgres returns the Store for a Postgres database whose flags table
+// has been migrated.
+func NewPostgres(db *sql.DB) *SQL {
+	return &SQL{db: newQuerier(db, DriverPostgres), driver: DriverPostgres, conn: db, flagMetadata: true}
+}
+
+// NewSQLite returns the Store for a SQLite database, creating any missing
+// tables.
+func NewSQLite(db *sql.DB) (*SQL, error) {
+	// SQLite allows one writer at a time; a single connection keeps a Tx
+	// from deadlocking against queries made outside it.
+	db.SetMaxOpenConns(1)
+	if err := CreateSchema(db, DriverSQLite); err != nil {
+		return nil, fmt.Errorf("creating schema: %w", err)
+	}
+	return &SQL{db: newQuerier(db, DriverSQLite), driver: DriverSQLite, conn: db, flagMetadata: true}, nil
+}
+
+// newQuerier wraps q to speak the dialect of driver and trace queries.
+func newQuerier(q querier, driver string) querier {
+	if driver == DriverSQLite {
+		q = sqliteQuerier{q}
+	}
+	return tracingQuerier{q}
+}
+
+func (p *SQL) Tx(fn func(Store) error) error {
+	return p.tx(func(tx *SQL) error { return fn(tx) })
+}
+
+// tx is Tx for methods that need the SQL of the transaction.
+func (p *SQL) tx(fn func(*SQL) error) error {
+	if p.conn == nil {
+		return fn(p)
+	}
+	tx, err := p.conn.Begin()
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer tx.Rollback()
+	if err := fn(&SQL{db: newQuerier(tx, p.driver), driver: p.driver, flagMetadata: p.flagMetadata}); err != nil {
+		return err
+	}
+	return wrapErr(tx.Commit())
+}
+
+// GetUserByEmail matches emails ignoring case, through the
+// users_email_lower index that CreateSchema and Migrate create.
+func (p *SQL) GetUserByEmail(email string) (*User, error) {
+	query := `SELECT id, email, name FROM users WHERE LOWER(email) = LOWER($1)`
+	row := p.db.QueryRow(query, email)
+	var user User
+	err := row.Scan(&user.ID, &user.Email, &user.Name)
+	if err != nil {
+		return nil, wrapScanErr(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+func (p *SQL) UserEmails(prefix string, limit int) ([]string, error) {
+	prefix = likeEscaper.Replace(prefix)
+	rows, err := p.db.Query(`SELECT email FROM users WHERE LOWER(email) LIKE LOWER($1) ESCAPE '\'
+		ORDER BY email LIMIT $2`, prefix+"%", limit)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+func (p *SQL) ListUsers() ([]User, error) {
+	rows, err := p.db.Query(`SELECT id, email, name FROM users ORDER BY email`)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (p *SQL) UserCandidates(term string, maxTypos int) ([]User, error) {
+	term = strings.ToLower(term)
+	n := utf8.RuneCountInString(term)
+	var pattern strings.Builder
+	pattern.WriteString("%")
+	for _, r := range term {
+		pattern.WriteString(likeEscaper.Replace(string(r)) + "%")
+	}
+	args := []any{pattern.String(), n - maxTypos, n + maxTypos}
+	conditions := []string{
+		`LOWER(email) LIKE $1 ESCAPE '\'`,
+		`LOWER(name) LIKE $1 ESCAPE '\'`,
+		`LENGTH(email) BETWEEN $2 AND $3`,
+		`LENGTH(name) BETWEEN $2 AND $3`,
+	}
+	// A local part of length l is l characters followed by the @.
+	for l := max(1, n-maxTypos); l <= n+maxTypos; l++ {
+		args = append(args, strings.Repeat("_", l)+"@%")
+		conditions = append(conditions, fmt.Sprintf("email LIKE $%d", len(args)))
+	}
+	rows, err := p.db.Query(`SELECT id, email, name FROM users WHERE `+
+		strings.Join(conditions, " OR ")+` ORDER BY email`, args...)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (p *SQL) GetAdmin(userID string) (*Admin, error) {
+	var admin Admin
+	err := p.db.QueryRow(`SELECT id, checkin_access, anticheat_access, qrmgmt_access,
+		question_management_access, communication_access, user_id, created_at, updated_at
+		FROM admins WHERE user_id = $1`, userID).
+		Scan(&admin.ID, &admin.CheckinAccess, &admin.AnticheatAccess,
+			&admin.QrmgmtAccess, &admin.QuestionManagementAccess,
+			&admin.CommunicationAccess, &admin.UserID,
+			&admin.CreatedAt, &admin.UpdatedAt)
+	if err != nil {
+		return nil, wrapScanErr(err, ErrAdminNotFound)
+	}
+	return &admin, nil
+}
+
+func (p *SQL) CreateAdmin(admin *Admin) error {
+	var existingAdminID string
+	err := p.db.QueryRow("SELECT id FROM admins WHERE user_id = $1", admin.UserID).Scan(&existingAdminID)
+	switch err := wrapScanErr(err, ErrAdminNotFound); {
+	case err == nil:
+		return ErrAdminExists
+	case !errors.Is(err, ErrAdminNotFound):
+		return err
+	}
+
+	_, err = p.db.Exec(`
+		INSERT INTO admins (id, checkin_access, anticheat_access, qrmgmt_access,
+		question_management_access, communication_access, user_id,
+		created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, admin.ID, admin.CheckinAccess, admin.AnticheatAccess, admin.QrmgmtAccess,
+		admin.QuestionManagementAccess, admin.CommunicationAccess, admin.UserID,
+		admin.CreatedAt, admin.UpdatedAt)
+	return wrapErr(err)
+}
+
+func (p *SQL) UpdateAdmin(admin *Admin) error {
+	admin.UpdatedAt = time.Now()
+	_, err := p.db.Exec(`
+		UPDATE admins SET checkin_access = $1, anticheat_access = $2, qrmgmt_access = $3,
+		question_management_access = $4, communication_access = $5, updated_at = $6
+		WHERE user_id = $7
+	`, admin.CheckinAccess, admin.AnticheatAccess, admin.QrmgmtAccess,
+		admin.QuestionManagementAccess, admin.CommunicationAccess, admin.UpdatedAt, admin.UserID)
+	return wrapErr(err)
+}
+
+func (p *SQL) DeleteAdmin(adminID string) error {
+	_, err := p.db.Exec("DELETE FROM qr_data where admin_id = $1", adminID)
+	if err != nil {
+		return wrapErr(err)
+	}
+	result, err := p.db.Exec("DELETE FROM admins WHERE id = $1", adminID)
+	if err != nil {
+		return wrapErr(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAdminNotFound
+	}
+	return nil
+}
+
+func (p *SQL) ListAdmins() ([]Admin, error) {
+	rows, err := p.db.Query(`
+		SELECT a.id, a.checkin_access, a.anticheat_access, a.qrmgmt_access,
+		a.question_management_access, a.communication_access, a.user_id,
+		a.created_at, a.updated_at, u.email, u.name
+		FROM admins a JOIN users u ON u.id = a.user_id
+		ORDER BY u.email`)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	var admins []Admin
+	for rows.Next() {
+		var admin Admin
+		err := rows.Scan(&admin.ID, &admin.CheckinAccess, &admin.AnticheatAccess,
+			&admin.QrmgmtAccess, &admin.QuestionManagementAccess, &admin.CommunicationAccess,
+			&admin.UserID, &admin.CreatedAt, &admin.UpdatedAt, &admin.User.Email, &admin.User.Name)
+		if err != nil {
+			return nil, err
+		}
+		admin.User.ID = admin.UserID
+		admins = append(admins, admin)
+	}
+	return admins, rows.Err()
+}
+
+func (p *SQL) ListFlags() ([]Flag, error) {
+	query := `SELECT name, value, description, owner, created_at, updated_at FROM flags ORDER BY name`
+	if !p.flagMetadata {
+		query = `SELECT name, value, '', '', NULL, NULL FROM flags ORDER BY name`
+	}
+	rows, err := p.db.Query(query)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+	var flags []Flag
+	for rows.Next() {
+		var flag Flag
+		var createdAt, updatedAt sql.NullTime
+		err = rows.Scan(&flag.Name, &flag.Value, &flag.Description, &flag.Owner, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		flag.CreatedAt, flag.UpdatedAt = createdAt.Time, updatedAt.Time
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
+
+func (p *SQL) CreateFlag(flag Flag) error {
+	if !p.flagMetadata {
+		if flag.Description != "" || flag.Owner != "" {
+			return &Error{Code: CodeSchemaOutdated, Err: errors.New("flags have no description or owner")}
+		}
+		_, err := p.db.Exec(`INSERT INTO flags (name, value) VALUES ($1, $2)`, flag.Name, flag.Value)
+		return wrapErr(err)
+	}
+	_, err := p.db.Exec(`INSERT INTO flags (name, value, description, owner, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, flag.Name, flag.Value, flag.Description, flag.Owner,
+		nullTime(flag.CreatedAt), nullTime(flag.UpdatedAt))
+	return wrapErr(err)
+}
+
+func (p *SQL) SetFlag(name string, value bool) error {
+	if !p.flagMetadata {
+		result, err := p.db.Exec(`UPDATE flags SET value = $1 WHERE name = $2`, value, name)
+		return flagUpdated(result, err)
+	}
+	result, err := p.db.Exec(`UPDATE flags SET value = $1, updated_at = $2 WHERE name = $3`,
+		value, time.Now(), name)
+	return flagUpdated(result, err)
+}
+
+func (p *SQL) DescribeFlag(name, owner, description string) error {
+	if !p.flagMetadata {
+		return &Error{Code: CodeSchemaOutdated, Err: errors.New("flags have no description or owner")}
+	}
+	result, err := p.db.Exec(`UPDATE flags SET owner = $1, description = $2, updated_at = $3 WHERE name = $4`,
+		owner, description, time.Now(), name)
+	return flagUpdated(result, err)
+}
+
+// flagUpdated returns ErrFlagNotFound if an UPDATE of a flag matched no
+// row.
+func flagUpdated(result sql.Result, err error) error {
+	if err != nil {
+		return wrapErr(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrFlagNotFound
+	}
+	return nil
+}
+
+func (p *SQL) ListWhitelist() ([]Whitelist, error) {
+	rows, err := p.db.Query(`SELECT id, name, email, user_id FROM whitelists ORDER BY email`)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+	var entries []Whitelist
+	for rows.Next() {
+		var entry Whitelist
+		var userID sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.Name, &entry.Email, &userID); err != nil {
+			return nil, err
+		}
+		entry.UserID = userID.String
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (p *SQL) AddWhitelist(entry *Whitelist) error {
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+	_, err := p.db.Exec(`INSERT INTO whitelists (id, name, email, user_id) VALUES ($1, $2, $3, $4)`,
+		entry.ID, entry.Name, entry.Email, nullString(entry.UserID))
+	return wrapErr(err)
+}
+
+func (p *SQL) LinkWhitelist() ([]Whitelist, error) {
+	var linked []Whitelist
+	err := p.tx(func(tx *SQL) error {
+		rows, err := tx.db.Query(`
+			SELECT id, name, email, user_id FROM (
+				SELECT w.id, w.name, w.email, ` + userIDByEmail("w.email") + ` AS user_id
+				FROM whitelists w
+				WHERE w.user_id IS NULL
+			) matched
+			WHERE user_id IS NOT NULL
+			ORDER BY email`)
+		if err != nil {
+			return wrapErr(err)
+		}
+		for rows.Next() {
+			var entry Whitelist
+			if err := rows.Scan(&entry.ID, &entry.Name, &entry.Email, &entry.UserID); err != nil {
+				rows.Close()
+				return err
+			}
+			linked = append(linked, entry)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, entry := range linked {
+			_, err := tx.db.Exec(`UPDATE whitelists SET user_id = $1 WHERE id = $2`, entry.UserID, entry.ID)
+			if err != nil {
+				return wrapErr(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return linked, nil
+}
+
+func (p *SQL) ClearWhitelist() error {
+	_, err := p.db.Exec(`DELETE FROM whitelists`)
+	return wrapErr(err)
+}
+
+// userIDByEmail is a subquery for the ID of the user whose email matches
+// the email column ignoring case. Where emails differ only in case it
+// picks one user, the same on every dialect, rather than matching twice.
+func userIDByEmail(email string) string {
+	return `(SELECT u.id FROM users u WHERE LOWER(u.email) = LOWER(` + email + `) ORDER BY u.id LIMIT 1)`
+}
+
+// nullTime stores a zero t as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nullString stores an empty s as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"database/sql"
+	"regexp"
+)
+
+var postgresPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+// sqliteQuerier rewrites the $1 placeholders of Postgres to the ?1 form
+// SQLite uses for numbered parameters.
+type sqliteQuerier struct {
+	q querier
+}
+
+func rebindSQLite(query string) string {
+	return postgresPlaceholder.ReplaceAllString(query, "?$1")
+}
+
+func (s sqliteQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	return s.q.Exec(rebindSQLite(query), args...)
+}
+
+func (s sqliteQuerier) Query(query string, args ...any) (*sql.Rows, error) {
+	return s.q.Query(rebindSQLite(query), args...)
+}
+
+func (s sqliteQuerier) QueryRow(query string, args ...any) *sql.Row {
+	return s.q.QueryRow(rebindSQLite(query), args...)
+}
+
+func (s sqliteQuerier) Prepare(query string) (*sql.Stmt, error) {
+	return s.q.Prepare(rebindSQLite(query))
+}
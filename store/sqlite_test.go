@@ -0,0 +1,30 @@
+//go:build cgo
+
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	testBackends[DriverSQLite] = openTestSQLite
+}
+
+// openTestSQLite returns a SQLite file in a temporary directory.
+func openTestSQLite(t *testing.T) (*sql.DB, *SQL) {
+	t.Helper()
+	db, err := sql.Open(DriverSQLite, "file:"+filepath.Join(t.TempDir(), "gocli.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	p, err := NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, p
+}
@@ -0,0 +1,158 @@
+// Package store is the data layer of gocli: the users, admins, flags and
+// whitelists tables behind a set of interfaces, with a SQL (Postgres or
+// SQLite) and an in-memory implementation. It does no printing or
+// prompting, so it can be used by other services as well as by the gocli
+// binary.
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Base struct {
+	ID        string    `json:"id,omitempty" yaml:"id,omitempty"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+func NewBase() Base {
+	return Base{
+		ID:        uuid.New().String(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+type User struct {
+	Base
+	Email string
+	Name  string
+}
+
+type Admin struct {
+	Base
+	CheckinAccess            bool
+	AnticheatAccess          bool
+	QrmgmtAccess             bool
+	QuestionManagementAccess bool
+	CommunicationAccess      bool
+	UserID                   string
+	User                     User
+}
+
+// NewAdmin returns an admin for user with no access.
+func NewAdmin(user User) Admin {
+	return Admin{
+		Base:   NewBase(),
+		UserID: user.ID,
+		User:   user,
+	}
+}
+
+// Flag is a feature switch of the main application. Dotted names put it
+// in a group: "checkin.open" is in the group "checkin". CreatedAt and
+// UpdatedAt are zero for flags made before gocli recorded them. Flags
+// are written whole to snapshots and fixtures.
+type Flag struct {
+	Base        `yaml:",inline"`
+	Name        string `json:"name" yaml:"name"`
+	Value       bool   `json:"value" yaml:"value"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner       string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// Group returns the namespace of the flag, the part of its name before
+// the last dot, or "" if it has none.
+func (f Flag) Group() string {
+	if i := strings.LastIndex(f.Name, "."); i >= 0 {
+		return f.Name[:i]
+	}
+	return ""
+}
+
+// InGroup reports whether the flag is in group or in a group nested in
+// it.
+func (f Flag) InGroup(group string) bool {
+	return strings.HasPrefix(f.Name, group+".")
+}
+
+// Whitelist is an entry of the whitelists table. UserID is empty until
+// the person registers as a user.
+type Whitelist struct {
+	ID     string
+	Name   string
+	Email  string
+	UserID string
+}
+
+type UserStore interface {
+	// GetUserByEmail returns ErrUserNotFound if no user has the email,
+	// ignoring case.
+	GetUserByEmail(email string) (*User, error)
+	// UserEmails returns up to limit emails starting with prefix,
+	// ignoring case, in order.
+	UserEmails(prefix string, limit int) ([]string, error)
+	// ListUsers returns every user, ordered by email.
+	ListUsers() ([]User, error)
+	// UserCandidates narrows the users down to those that may match term
+	// with up to maxTypos typos, ordered by email: users whose email or
+	// name holds the letters of term in order, ignoring case, or whose
+	// email, local part or name is within maxTypos characters of its
+	// length. Ranking the candidates is up to the caller.
+	UserCandidates(term string, maxTypos int) ([]User, error)
+}
+
+type AdminStore interface {
+	// GetAdmin returns the admin of a user, or ErrAdminNotFound.
+	GetAdmin(userID string) (*Admin, error)
+	// CreateAdmin returns ErrAdminExists if the user already is one.
+	CreateAdmin(admin *Admin) error
+	// UpdateAdmin saves the permissions of admin and bumps UpdatedAt.
+	UpdateAdmin(admin *Admin) error
+	// DeleteAdmin deletes an admin by ID together with its qr_data.
+	DeleteAdmin(adminID string) error
+	// ListAdmins returns every admin with User filled in, ordered by
+	// email.
+	ListAdmins() ([]Admin, error)
+}
+
+type FlagStore interface {
+	ListFlags() ([]Flag, error)
+	// CreateFlag adds a flag, which must not exist yet, with its
+	// description, owner and timestamps. Zero timestamps are left unknown.
+	CreateFlag(flag Flag) error
+	// SetFlag changes the value of a flag, or returns ErrFlagNotFound.
+	SetFlag(name string, value bool) error
+	// DescribeFlag records what a flag is for and who owns it, or returns
+	// ErrFlagNotFound.
+	DescribeFlag(name, owner, description string) error
+}
+
+type WhitelistStore interface {
+	ListWhitelist() ([]Whitelist, error)
+	AddWhitelist(entry *Whitelist) error
+	// AddWhitelistBatch adds entries in bulk, all or none. Entries without
+	// a UserID are linked to the user with the same email, ignoring case;
+	// it returns how many entries ended up linked. progress, if not nil, is
+	// called with the number of entries written so far. An error caused
+	// by one of the entries is an *EntryError.
+	AddWhitelistBatch(entries []Whitelist, progress func(done int)) (linked int, err error)
+	// LinkWhitelist links the unlinked entries whose email a user has
+	// since registered with, ignoring case, and returns them.
+	LinkWhitelist() ([]Whitelist, error)
+	ClearWhitelist() error
+}
+
+// Store is the whole data layer.
+type Store interface {
+	UserStore
+	AdminStore
+	FlagStore
+	WhitelistStore
+	// Tx runs fn with a Store whose changes are committed together if fn
+	// returns nil and rolled back otherwise.
+	Tx(fn func(Store) error) error
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// tracingQuerier logs every query at debug level with its arguments and
+// how long it took.
+type tracingQuerier struct {
+	q querier
+}
+
+func (t tracingQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	result, err := t.q.Exec(query, args...)
+	trace(query, args, start, err)
+	return result, err
+}
+
+func (t tracingQuerier) Query(query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := t.q.Query(query, args...)
+	trace(query, args, start, err)
+	return rows, err
+}
+
+// QueryRow is traced without its error, which only surfaces on Scan.
+func (t tracingQuerier) QueryRow(query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := t.q.QueryRow(query, args...)
+	trace(query, args, start, nil)
+	return row
+}
+
+func (t tracingQuerier) Prepare(query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := t.q.Prepare(query)
+	trace(query, nil, start, err)
+	return stmt, err
+}
+
+func trace(query string, args []any, start time.Time, err error) {
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	attrs := []any{
+		"query", strings.Join(strings.Fields(query), " "),
+		"args", args,
+		"duration", time.Since(start),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	slog.Debug("sql", attrs...)
+}
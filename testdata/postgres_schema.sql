@@ -0,0 +1,33 @@
+-- The tables gocli works on as the main application creates them, with
+-- uuid ids and no flag metadata, for the Postgres tests. gocli's own
+-- schema (store.CreateSchema) is all TEXT and would hide type mismatches.
+CREATE TABLE users (
+	id uuid PRIMARY KEY,
+	email text NOT NULL UNIQUE,
+	name text NOT NULL DEFAULT ''
+);
+CREATE TABLE admins (
+	id uuid PRIMARY KEY,
+	checkin_access boolean NOT NULL DEFAULT false,
+	anticheat_access boolean NOT NULL DEFAULT false,
+	qrmgmt_access boolean NOT NULL DEFAULT false,
+	question_management_access boolean NOT NULL DEFAULT false,
+	communication_access boolean NOT NULL DEFAULT false,
+	user_id uuid NOT NULL UNIQUE REFERENCES users (id),
+	created_at timestamptz NOT NULL,
+	updated_at timestamptz NOT NULL
+);
+CREATE TABLE qr_data (
+	id uuid PRIMARY KEY,
+	admin_id uuid NOT NULL REFERENCES admins (id)
+);
+CREATE TABLE flags (
+	name text PRIMARY KEY,
+	value boolean NOT NULL DEFAULT false
+);
+CREATE TABLE whitelists (
+	id uuid PRIMARY KEY,
+	name text NOT NULL,
+	email text NOT NULL,
+	user_id uuid REFERENCES users (id)
+);
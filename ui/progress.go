@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// progressBarWidth is how many cells the bar itself takes.
+	progressBarWidth = 30
+	// progressInterval is how often the bar is redrawn at most.
+	progressInterval = 100 * time.Millisecond
+)
+
+// Progress is a bar showing how far a long task has got and how fast it
+// goes. It is drawn on the error output, and only when that is a terminal,
+// so it never ends up in redirected output or logs.
+type Progress struct {
+	u      *UI
+	label  string
+	total  int
+	done   int
+	start  time.Time
+	drawn  time.Time
+	active bool
+}
+
+// NewProgress starts a bar for total items.
+func (u *UI) NewProgress(label string, total int) *Progress {
+	return &Progress{u: u, label: label, total: total, start: time.Now(), active: isTerminal(u.Err)}
+}
+
+// Set records that done items are finished.
+func (p *Progress) Set(done int) {
+	p.done = done
+	if p.active && time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// Done draws the bar a last time and moves past it.
+func (p *Progress) Done() {
+	if !p.active {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.u.Err)
+	p.active = false
+}
+
+func (p *Progress) draw() {
+	p.drawn = time.Now()
+	fmt.Fprintf(p.u.Err, "\r%s", p.render(p.drawn.Sub(p.start)))
+}
+
+// render is the line showing the progress after elapsed.
+func (p *Progress) render(elapsed time.Duration) string {
+	filled := progressBarWidth
+	if p.total > 0 {
+		filled = min(progressBarWidth, progressBarWidth*p.done/p.total)
+	}
+	rate := 0
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		rate = int(float64(p.done) / seconds)
+	}
+	return fmt.Sprintf("%s [%s%s] %d/%d rows, %d rows/s",
+		p.label, strings.Repeat("#", filled), strings.Repeat(" ", progressBarWidth-filled),
+		p.done, p.total, rate)
+}
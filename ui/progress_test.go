@@ -0,0 +1,26 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressRender(t *testing.T) {
+	p := New(strings.NewReader(""), &strings.Builder{}, &strings.Builder{}).NewProgress("Importing", 200)
+	p.Set(50)
+	want := "Importing [#######                       ] 50/200 rows, 25 rows/s"
+	if got := p.render(2 * time.Second); got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+}
+
+func TestProgressSilentOffTerminal(t *testing.T) {
+	var errOut strings.Builder
+	p := New(strings.NewReader(""), &strings.Builder{}, &errOut).NewProgress("Importing", 10)
+	p.Set(10)
+	p.Done()
+	if errOut.Len() != 0 {
+		t.Errorf("drew %q to a non-terminal", errOut.String())
+	}
+}
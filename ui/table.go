@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// minColumnWidth is how narrow wrapping may make a column.
+const minColumnWidth = 6
+
+// Table is a bordered grid of text. Cells are padded by display width, so
+// accented and CJK text lines up, and wrapped when the table is wider
+// than the terminal.
+type Table struct {
+	Headers []string
+	// HeaderStyle styles the header cells, e.g. Theme.Magenta+Theme.Bold.
+	HeaderStyle string
+	// MaxCellWidth truncates longer cells with an ellipsis; 0 means no
+	// limit.
+	MaxCellWidth int
+	// Separators draws a line between rows as well as around them.
+	Separators bool
+	// Footer is an optional last row, such as totals, set apart from the
+	// others and styled like the header.
+	Footer []string
+
+	rows []tableRow
+}
+
+type tableRow struct {
+	style string
+	cells []string
+}
+
+// AddRow adds a row drawn in style, which may be empty.
+func (t *Table) AddRow(style string, cells ...string) {
+	t.rows = append(t.rows, tableRow{style: style, cells: cells})
+}
+
+// SortBy orders the rows by the text of a column, keeping the order of
+// equal rows.
+func (t *Table) SortBy(column int, descending bool) {
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		a, b := t.rows[i].cell(column), t.rows[j].cell(column)
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+}
+
+func (r tableRow) cell(column int) string {
+	if column < len(r.cells) {
+		return r.cells[column]
+	}
+	return ""
+}
+
+// PrintTable prints t to the output, no wider than Width when it is set.
+func (u *UI) PrintTable(t *Table) {
+	rows := append([]tableRow{{style: t.HeaderStyle, cells: t.Headers}}, t.rows...)
+	if t.Footer != nil {
+		rows = append(rows, tableRow{style: t.HeaderStyle, cells: t.Footer})
+	}
+	for i, row := range rows {
+		cells := make([]string, len(t.Headers))
+		for j := range cells {
+			cells[j] = row.cell(j)
+			if t.MaxCellWidth > 0 {
+				cells[j] = runewidth.Truncate(cells[j], t.MaxCellWidth, "…")
+			}
+		}
+		rows[i].cells = cells
+	}
+	widths := columnWidths(rows, len(t.Headers), u.Width)
+
+	border := "+"
+	for _, width := range widths {
+		border += strings.Repeat("-", width+2) + "+"
+	}
+	u.Println(border)
+	for i, row := range rows {
+		u.printTableRow(widths, row)
+		footer := t.Footer != nil && i == len(rows)-2
+		if i == 0 || t.Separators || footer || i == len(rows)-1 {
+			u.Println(border)
+		}
+	}
+}
+
+// columnWidths fits each column to its widest cell, then narrows the
+// widest columns until the table fits in maxWidth, if that is set.
+func columnWidths(rows []tableRow, columns, maxWidth int) []int {
+	widths := make([]int, columns)
+	for _, row := range rows {
+		for j, cell := range row.cells {
+			widths[j] = max(widths[j], runewidth.StringWidth(cell))
+		}
+	}
+	if maxWidth <= 0 {
+		return widths
+	}
+	// Each column takes its width plus "| " before and a space after, and
+	// the last one a closing "|".
+	for total(widths)+3*columns+1 > maxWidth {
+		widest := 0
+		for j := range widths {
+			if widths[j] > widths[widest] {
+				widest = j
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			break
+		}
+		widths[widest]--
+	}
+	return widths
+}
+
+func total(widths []int) int {
+	sum := 0
+	for _, width := range widths {
+		sum += width
+	}
+	return sum
+}
+
+func (u *UI) printTableRow(widths []int, row tableRow) {
+	lines := make([][]string, len(widths))
+	height := 1
+	for j, cell := range row.cells {
+		lines[j] = wrap(cell, widths[j])
+		height = max(height, len(lines[j]))
+	}
+	for i := 0; i < height; i++ {
+		u.Print("|")
+		for j, width := range widths {
+			text := ""
+			if i < len(lines[j]) {
+				text = lines[j][i]
+			}
+			u.Printf(" %s%s%s |", row.style, runewidth.FillRight(text, width), u.Theme.Reset)
+		}
+		u.Println()
+	}
+}
+
+// wrap breaks s into lines of at most width columns, between words where
+// it can.
+func wrap(s string, width int) []string {
+	if runewidth.StringWidth(s) <= width {
+		return []string{s}
+	}
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for runewidth.StringWidth(word) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			head := runewidth.Truncate(word, width, "")
+			if head == "" {
+				// A character wider than the column gets a line of its own.
+				_, size := utf8.DecodeRuneInString(word)
+				head = word[:size]
+			}
+			lines = append(lines, head)
+			word = word[len(head):]
+		}
+		switch {
+		case line == "":
+			line = word
+		case runewidth.StringWidth(line)+1+runewidth.StringWidth(word) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-runewidth"
+)
+
+func printTable(t *testing.T, width int, table *Table) []string {
+	t.Helper()
+	var out strings.Builder
+	u := New(strings.NewReader(""), &out, &out)
+	u.Width = width
+	u.PrintTable(table)
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestTableAlignsWideCharacters(t *testing.T) {
+	table := &Table{Headers: []string{"Name", "Email"}}
+	table.AddRow("", "José", "jose@example.com")
+	table.AddRow("", "山田太郎", "taro@example.com")
+	lines := printTable(t, 0, table)
+
+	want := []string{
+		"+----------+------------------+",
+		"| Name     | Email            |",
+		"+----------+------------------+",
+		"| José     | jose@example.com |",
+		"| 山田太郎 | taro@example.com |",
+		"+----------+------------------+",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTableWrapsToWidth(t *testing.T) {
+	table := &Table{Headers: []string{"Flag", "Description"}}
+	table.AddRow("", "registration", "whether new participants can sign up for the event")
+	lines := printTable(t, 40, table)
+	for _, line := range lines {
+		if width := runewidth.StringWidth(line); width > 40 {
+			t.Errorf("line %q is %d wide, want at most 40", line, width)
+		}
+	}
+	if len(lines) <= 5 {
+		t.Errorf("description was not wrapped:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestTableTruncatesAndSorts(t *testing.T) {
+	table := &Table{Headers: []string{"Email"}, MaxCellWidth: 8}
+	table.AddRow("", "zed@example.com")
+	table.AddRow("", "amy@example.com")
+	table.SortBy(0, false)
+	lines := printTable(t, 0, table)
+	if lines[3] != "| amy@exa… |" || lines[4] != "| zed@exa… |" {
+		t.Errorf("got\n%s", strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,68 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Theme holds the escape sequences gocli styles its output with. The zero
+// Theme styles nothing.
+type Theme struct {
+	Reset, Bold                             string
+	Red, Green, Yellow, Blue, Magenta, Cyan string
+}
+
+// ANSI is the Theme for terminals.
+var ANSI = Theme{
+	Reset:   "\033[0m",
+	Bold:    "\033[1m",
+	Red:     "\033[31m",
+	Green:   "\033[32m",
+	Yellow:  "\033[33m",
+	Blue:    "\033[34m",
+	Magenta: "\033[35m",
+	Cyan:    "\033[36m",
+}
+
+// ColorMode is the value of the --color option.
+type ColorMode string
+
+const (
+	ColorAuto   ColorMode = "auto"
+	ColorAlways ColorMode = "always"
+	ColorNever  ColorMode = "never"
+)
+
+func ParseColorMode(s string) (ColorMode, error) {
+	switch mode := ColorMode(s); mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid color mode %q, want auto, always or never", s)
+}
+
+// ThemeFor returns the Theme for output to w. In auto mode output is
+// colored only when w is a terminal, NO_COLOR is unset or empty and TERM
+// is not dumb.
+func ThemeFor(mode ColorMode, w io.Writer) Theme {
+	switch mode {
+	case ColorAlways:
+		return ANSI
+	case ColorNever:
+		return Theme{}
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" || !isTerminal(w) {
+		return Theme{}
+	}
+	return ANSI
+}
+
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,120 @@
+// Package ui is the terminal of gocli: where output is printed and where
+// answers to prompts are read from. Commands talk to a *UI instead of
+// os.Stdin and os.Stdout, so they can be embedded in other programs and
+// driven by tests.
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrCancelled is returned by operations the user backed out of at a
+// prompt.
+var ErrCancelled = errors.New("cancelled")
+
+// LineReader is an interactive line source such as a readline instance.
+type LineReader interface {
+	Readline() (string, error)
+	SetPrompt(prompt string)
+}
+
+type UI struct {
+	Out io.Writer
+	Err io.Writer
+	// Theme styles the output, plain unless Out is a terminal.
+	Theme Theme
+	// ErrTheme styles what is written to Err, plain unless Err is a
+	// terminal, so that redirecting either one keeps escape codes out of
+	// the file.
+	ErrTheme Theme
+	// Width is the width of the terminal tables are fitted to, or 0 when
+	// output is not to a terminal.
+	Width int
+
+	in     *bufio.Reader
+	lines  LineReader
+	prompt string
+}
+
+// New returns a UI reading lines from in. Prompts go to out.
+func New(in io.Reader, out, errOut io.Writer) *UI {
+	return &UI{
+		Out:      out,
+		Err:      errOut,
+		Theme:    ThemeFor(ColorAuto, out),
+		ErrTheme: ThemeFor(ColorAuto, errOut),
+		in:       bufio.NewReader(in),
+	}
+}
+
+func (u *UI) Printf(format string, args ...any) {
+	fmt.Fprintf(u.Out, format, args...)
+}
+
+func (u *UI) Print(args ...any) {
+	fmt.Fprint(u.Out, args...)
+}
+
+func (u *UI) Println(args ...any) {
+	fmt.Fprintln(u.Out, args...)
+}
+
+// Errorf prints diagnostics that are not part of the output, such as
+// connection notices, to the error writer. Styles in format should come
+// from ErrTheme.
+func (u *UI) Errorf(format string, args ...any) {
+	fmt.Fprintf(u.Err, format, args...)
+}
+
+// SetLineReader makes the UI read lines from r, e.g. a readline instance
+// on a terminal, instead of its input. Passing nil switches back.
+func (u *UI) SetLineReader(r LineReader) {
+	u.lines = r
+	if r != nil {
+		r.SetPrompt(u.prompt)
+	}
+}
+
+// SetPrompt sets the prompt printed by ReadLine.
+func (u *UI) SetPrompt(prompt string) {
+	u.prompt = prompt
+	if u.lines != nil {
+		u.lines.SetPrompt(prompt)
+	}
+}
+
+// ReadLine prints the prompt and reads a line without its line ending. It
+// returns io.EOF when the input is exhausted.
+func (u *UI) ReadLine() (string, error) {
+	if u.lines != nil {
+		return u.lines.Readline()
+	}
+	u.Print(u.prompt)
+	line, err := u.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Ask prints a one-off prompt and returns the answer with surrounding
+// space trimmed. An exhausted input is an empty answer; any other read
+// error, such as Ctrl-C on a terminal, returns ErrCancelled.
+func (u *UI) Ask(prompt string) (string, error) {
+	saved := u.prompt
+	u.SetPrompt(prompt)
+	defer u.SetPrompt(saved)
+	answer, err := u.ReadLine()
+	if err == io.EOF {
+		u.Println()
+		return "", nil
+	}
+	if err != nil {
+		return "", ErrCancelled
+	}
+	return strings.TrimSpace(answer), nil
+}
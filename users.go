@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qwerty-dvorak/gocli/cli"
+	"github.com/qwerty-dvorak/gocli/mailaddr"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+var foldGmail = flag.Bool("fold-gmail", false, "treat Gmail addresses that differ only in dots or +tags as the same person")
+
+const (
+	// searchLimit caps the users listed by users search.
+	searchLimit = 20
+	// suggestionLimit caps the emails suggested for a mistyped one.
+	suggestionLimit = 3
+)
+
+// emailKey is what emails are compared by: trimmed, lowercased and, with
+// --fold-gmail, folded.
+func emailKey(address string) string {
+	key := strings.ToLower(strings.TrimSpace(address))
+	if *foldGmail {
+		key = mailaddr.FoldGmail(key)
+	}
+	return key
+}
+
+// findUser looks up the user with a normalized email. With --fold-gmail a
+// miss falls back to comparing folded addresses, as users are stored with
+// the address they registered with.
+func findUser(email string, st store.Store) (*store.User, error) {
+	user, err := st.GetUserByEmail(email)
+	if !errors.Is(err, store.ErrUserNotFound) || !*foldGmail || mailaddr.FoldGmail(email) == email {
+		return user, err
+	}
+	users, listErr := st.ListUsers()
+	if listErr != nil {
+		return nil, listErr
+	}
+	for i := range users {
+		if emailKey(users[i].Email) == emailKey(email) {
+			return &users[i], nil
+		}
+	}
+	return nil, err
+}
+
+// registerUserCommands registers users search, which is also a command of
+// the admin prompt, where users are looked up to make them admins.
+func registerUserCommands() {
+	search := &cli.Func{
+		Use:   "search <term>...",
+		Short: "find users by name or email, allowing typos",
+		RunFunc: func(st store.Store, args []string) error {
+			term := strings.Join(args, " ")
+			users, err := SearchUsers(term, searchLimit, st)
+			if err != nil {
+				return fmt.Errorf("searching users: %w", err)
+			}
+			if len(users) == 0 {
+				console.Printf("%sNo users match %s%s\n", yellow, term, reset)
+				return nil
+			}
+			table := newTable("Name", "Email")
+			for _, user := range users {
+				table.AddRow("", user.Name, user.Email)
+			}
+			console.PrintTable(table)
+			return nil
+		},
+	}
+	cli.Register("users", search)
+	cli.Register("admin", search)
+}
+
+// SearchUsers returns up to limit users whose name or email matches term,
+// best matches first. Matching ignores case and, failing exact and
+// substring matches, allows the letters of term to be spread out or to
+// contain a few typos. The store narrows the users down to those that
+// can match before they are ranked, so the users table is not read whole.
+func SearchUsers(term string, limit int, st store.Store) ([]store.User, error) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return nil, nil
+	}
+	users, err := st.UserCandidates(term, maxTypos(term))
+	if err != nil {
+		return nil, err
+	}
+	type match struct {
+		user  store.User
+		score int
+	}
+	var matches []match
+	for _, user := range users {
+		if score, ok := matchUser(term, user); ok {
+			matches = append(matches, match{user, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+
+	var found []store.User
+	for i := 0; i < len(matches) && i < limit; i++ {
+		found = append(found, matches[i].user)
+	}
+	return found, nil
+}
+
+// matchUser scores how well term matches user, lower being better.
+func matchUser(term string, user store.User) (int, bool) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return 0, false
+	}
+	email := strings.ToLower(user.Email)
+	name := strings.ToLower(user.Name)
+	local, _, _ := strings.Cut(email, "@")
+
+	switch {
+	case email == term || name == term:
+		return 0, true
+	case strings.Contains(email, term) || strings.Contains(name, term):
+		return 1, true
+	case isSubsequence(term, email) || isSubsequence(term, name):
+		return 2, true
+	}
+	distance := min(editDistance(term, email), editDistance(term, local), editDistance(term, name))
+	if distance <= maxTypos(term) {
+		return 2 + distance, true
+	}
+	return 0, false
+}
+
+// maxTypos is how many edits a term of that length may be away from a
+// match: one per six characters, at least one.
+func maxTypos(term string) int {
+	return max(1, len([]rune(term))/6)
+}
+
+func isSubsequence(term, s string) bool {
+	rest := []rune(term)
+	for _, r := range s {
+		if len(rest) > 0 && r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+// editDistance is the number of insertions, deletions, substitutions and
+// swaps of adjacent characters that turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// suggestEmails returns the emails of the users most like email, for a
+// "did you mean" hint after a failed lookup.
+func suggestEmails(email string, st store.Store) []string {
+	users, err := SearchUsers(email, suggestionLimit, st)
+	if err != nil {
+		return nil
+	}
+	emails := make([]string, len(users))
+	for i, user := range users {
+		emails[i] = user.Email
+	}
+	return emails
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qwerty-dvorak/gocli/basic"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+func TestSearchUsers(t *testing.T) {
+	users := []store.User{
+		{Email: "alice@example.com", Name: "Alice Liddell"},
+		{Email: "jose@example.com", Name: "José Núñez"},
+		{Email: "bob@example.org", Name: "Bob"},
+	}
+	memory := store.NewMemory()
+	for _, user := range users {
+		memory.AddUser(user)
+	}
+	db, sqlStore := openTestDB(t)
+	for _, user := range users {
+		if _, err := db.Exec(`INSERT INTO users (id, email, name) VALUES ($1, $2, $3)`,
+			store.NewBase().ID, user.Email, user.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, st := range map[string]store.Store{"memory": memory, "sql": sqlStore} {
+		t.Run(name, func(t *testing.T) {
+
+			for _, test := range []struct {
+				term string
+				want []string
+			}{
+				{"ALICE", []string{"alice@example.com"}},
+				{"núñez", []string{"jose@example.com"}},
+				{"jsoe", []string{"jose@example.com"}},
+				{"example.org", []string{"bob@example.org"}},
+				{"zzzz", nil},
+			} {
+				users, err := SearchUsers(test.term, searchLimit, st)
+				if err != nil {
+					t.Fatalf("SearchUsers(%q): %v", test.term, err)
+				}
+				var got []string
+				for _, user := range users {
+					got = append(got, user.Email)
+				}
+				if strings.Join(got, ",") != strings.Join(test.want, ",") {
+					t.Errorf("SearchUsers(%q) = %v, want %v", test.term, got, test.want)
+				}
+			}
+
+			// Only users that can match are read: alice's email holds no
+			// "example.org" and neither it, her local part nor her name is
+			// about as long, while José's name is.
+			users, err := st.UserCandidates("example.org", maxTypos("example.org"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, user := range users {
+				got = append(got, user.Email)
+			}
+			if want := "bob@example.org,jose@example.com"; strings.Join(got, ",") != want {
+				t.Errorf("UserCandidates(example.org) = %v, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestAddAdminSuggestsEmails(t *testing.T) {
+	st := store.NewMemory()
+	st.AddUser(store.User{Email: "alice@example.com", Name: "Alice"})
+
+	cmd := registeredCommand(t, "admin", "add")
+	var err error
+	withStdio(t, "", func() { err = cmd.Run(st, []string{"alcie@example.com"}) })
+	if err == nil || !strings.Contains(err.Error(), "Did you mean alice@example.com?") {
+		t.Errorf("got %v, want a suggestion of alice@example.com", err)
+	}
+}
+
+func TestFindUserFoldsGmail(t *testing.T) {
+	st := store.NewMemory()
+	st.AddUser(store.User{Email: "Ada.Lovelace@gmail.com", Name: "Ada"})
+
+	if _, err := findUser("adalovelace+gocli@gmail.com", st); !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("without --fold-gmail: got %v, want %v", err, store.ErrUserNotFound)
+	}
+	*foldGmail = true
+	defer func() { *foldGmail = false }()
+	user, err := findUser("adalovelace+gocli@googlemail.com", st)
+	if err != nil {
+		t.Fatalf("with --fold-gmail: %v", err)
+	}
+	if user.Name != "Ada" {
+		t.Errorf("found %+v, want Ada", user)
+	}
+}
+
+func TestCompleteUsersIgnoresCase(t *testing.T) {
+	memory := store.NewMemory()
+	memory.AddUser(store.User{Email: "Alice@example.com", Name: "Alice"})
+	db, sqlStore := openTestDB(t)
+	addTestUser(t, db, "Alice@example.com")
+
+	for name, st := range map[string]store.Store{"memory": memory, "sql": sqlStore} {
+		got := completeUsers(st, "admin add aLI")
+		if want := "aLIce@example.com"; len(got) != 1 || got[0] != want {
+			t.Errorf("%s: completeUsers = %q, want [%s]", name, got, want)
+		}
+	}
+}
+
+func TestAdminHelpListsUserSearch(t *testing.T) {
+	output := withStdio(t, "", func() { printContextUsage("admin") })
+	if !strings.Contains(output, "'search <term>...'") {
+		t.Errorf("admin help does not list search:\n%s", output)
+	}
+	if registeredCommand(t, "admin", "search") != registeredCommand(t, "users", "search") {
+		t.Error("admin search and users search are different commands")
+	}
+}
+
+// A fresh database can look users up by email without scanning them all.
+func TestCreateSchemaIndexesEmails(t *testing.T) {
+	db, _, err := basic.Open("sqlite://" + filepath.Join(t.TempDir(), "new.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := store.Open(db, store.DriverSQLite); err != nil {
+		t.Fatal(err)
+	}
+	var plan string
+	err = db.QueryRow(`EXPLAIN QUERY PLAN SELECT id FROM users WHERE LOWER(email) = LOWER(?)`, "a@b.c").
+		Scan(new(int), new(int), new(int), &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan, "users_email_lower") {
+		t.Errorf("query plan %q does not use users_email_lower", plan)
+	}
+}
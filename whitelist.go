@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qwerty-dvorak/gocli/cli"
+	"github.com/qwerty-dvorak/gocli/mailaddr"
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+const (
+	whitelistFile        = "whitelist.csv"
+	whitelistRejectsFile = "whitelist.rejects.csv"
+)
+
+// Reasons a whitelist row is rejected, in the order the summary lists them.
+const (
+	rejectMalformed   = "malformed row"
+	rejectEmail       = "invalid email"
+	rejectDuplicate   = "duplicate in file"
+	rejectWhitelisted = "already whitelisted"
+)
+
+var rejectReasons = []string{rejectMalformed, rejectEmail, rejectDuplicate, rejectWhitelisted}
+
+func registerWhitelistCommands() {
+	cli.Register("whitelist", &cli.Func{
+		Use:   "add",
+		Short: "seed csv",
+		RunFunc: func(st store.Store, args []string) error {
+			if err := AddWhitelist(st); err != nil {
+				return fmt.Errorf("adding whitelist: %w", err)
+			}
+			return nil
+		},
+	})
+	cli.Register("whitelist", &cli.Func{
+		Use:          "export [--status=linked|unlinked] [file]",
+		Short:        "export the whitelist to a csv/json file",
+		CompleteFunc: completeFiles,
+		RunFunc: func(st store.Store, args []string) error {
+			status, filename, err := parseExportArgs(args)
+			if err != nil {
+				return err
+			}
+			records, err := ExportWhitelist(status, st)
+			if err != nil {
+				return fmt.Errorf("exporting whitelist: %w", err)
+			}
+			if err := writeWhitelistRecords(filename, records); err != nil {
+				return fmt.Errorf("exporting whitelist: %w", err)
+			}
+			if filename != "" && filename != "-" {
+				console.Printf("%sExported %d whitelist entries to %s%s\n", green, len(records), filename, reset)
+			}
+			return nil
+		},
+	})
+	cli.Register("whitelist", &cli.Func{
+		Use:          "reconcile [file]",
+		Short:        "compare the whitelist with registered users",
+		CompleteFunc: completeFiles,
+		RunFunc: func(st store.Store, args []string) error {
+			filename := ""
+			if len(args) > 0 {
+				filename = args[0]
+			}
+			records, err := ReconcileWhitelist(st)
+			if err != nil {
+				return fmt.Errorf("reconciling whitelist: %w", err)
+			}
+			if err := writeWhitelistRecords(filename, records); err != nil {
+				return fmt.Errorf("reconciling whitelist: %w", err)
+			}
+			if filename != "" && filename != "-" {
+				printReconcileSummary(records)
+				console.Printf("%sWrote %d people to %s%s\n", green, len(records), filename, reset)
+			}
+			return nil
+		},
+	})
+	cli.Register("whitelist", &cli.Func{
+		Use:   "watch [--interval=5s]",
+		Short: "link entries to users as they register, until Ctrl-C",
+		RunFunc: func(st store.Store, args []string) error {
+			interval, err := parseWatchArgs(args)
+			if err != nil {
+				return err
+			}
+			return runWhitelistWatch(st, interval)
+		},
+	})
+}
+
+// whitelistRow is a row of whitelist.csv: a name in the first column and
+// an email in the third. source is the row as it appears in the file, so
+// that a rejected row can be written back even when it does not parse.
+type whitelistRow struct {
+	line   int
+	source string
+	Name   string
+	Email  string
+}
+
+// whitelistReject is a row left out of an import and why.
+type whitelistReject struct {
+	row    whitelistRow
+	detail string
+}
+
+// WhitelistReport counts what an import did with each row.
+type WhitelistReport struct {
+	Linked   int
+	Unlinked int
+	Rejected map[string]int
+
+	header  string
+	rejects []whitelistReject
+}
+
+func (r *WhitelistReport) reject(row whitelistRow, reason, detail string) {
+	if r.Rejected == nil {
+		r.Rejected = make(map[string]int)
+	}
+	r.Rejected[reason]++
+	r.rejects = append(r.rejects, whitelistReject{row: row, detail: detail})
+}
+
+// AddWhitelist imports whitelist.csv, writes the rows it rejected to
+// whitelist.rejects.csv and prints a summary.
+func AddWhitelist(st store.Store) error {
+	report, err := ImportWhitelist(whitelistFile, st)
+	if err != nil {
+		return err
+	}
+	if err := writeWhitelistRejects(whitelistRejectsFile, report); err != nil {
+		return err
+	}
+	printWhitelistReport(report)
+	return nil
+}
+
+// ImportWhitelist adds every valid row of a whitelist csv, linking those
+// whose email belongs to a registered user. Every row is validated before
+// anything is written: rows with a malformed line or email, a repeated
+// email or one already whitelisted are rejected and reported instead. The
+// accepted rows are then written in bulk, all or none, and matched to
+// users in one go rather than row by row.
+func ImportWhitelist(filename string, st store.Store) (*WhitelistReport, error) {
+	report := &WhitelistReport{}
+	rows, err := readWhitelist(filename, report)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = validateWhitelist(rows, st, report)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]store.Whitelist, len(rows))
+	for i, row := range rows {
+		entries[i] = store.Whitelist{Name: row.Name, Email: row.Email}
+	}
+	if *foldGmail {
+		if err := linkFoldedEmails(entries, st); err != nil {
+			return nil, err
+		}
+	}
+
+	progress := console.NewProgress("Importing whitelist", len(entries))
+	linked, err := st.AddWhitelistBatch(entries, progress.Set)
+	progress.Done()
+	var entryErr *store.EntryError
+	if errors.As(err, &entryErr) {
+		// Emails are unique by now, so the email finds the row.
+		subject := entryErr.Entry.Email
+		for _, row := range rows {
+			if row.Email == entryErr.Entry.Email {
+				subject = fmt.Sprintf("%s on line %d of %s", row.Email, row.line, filename)
+			}
+		}
+		return nil, &opError{op: "inserting into whitelist", subject: subject, err: entryErr.Err}
+	}
+	if err != nil {
+		return nil, &opError{op: "inserting into whitelist", subject: filename, err: err}
+	}
+	report.Linked = linked
+	report.Unlinked = len(entries) - linked
+	return report, nil
+}
+
+// linkFoldedEmails links entries to users whose email only matches once
+// folded, which the store cannot match by itself.
+func linkFoldedEmails(entries []store.Whitelist, st store.Store) error {
+	users, err := st.ListUsers()
+	if err != nil {
+		return err
+	}
+	userIDs := make(map[string]string, len(users))
+	for _, user := range users {
+		userIDs[emailKey(user.Email)] = user.ID
+	}
+	for i := range entries {
+		entries[i].UserID = userIDs[emailKey(entries[i].Email)]
+	}
+	return nil
+}
+
+// readWhitelist reads the rows of a whitelist csv, rejecting those that do
+// not parse or have fewer than three columns.
+func readWhitelist(filename string, report *WhitelistReport) ([]whitelistRow, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	// source returns the text of the file from start to where the reader
+	// is, without the line break that ends it.
+	source := func(start int64) string {
+		return strings.TrimRight(string(data[start:reader.InputOffset()]), "\r\n")
+	}
+	if _, err := reader.Read(); err == io.EOF {
+		return nil, fmt.Errorf("%s is empty", filename)
+	} else if err != nil {
+		return nil, err
+	}
+	report.header = source(0)
+
+	var rows []whitelistRow
+	for {
+		start := reader.InputOffset()
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			row := whitelistRow{line: parseErr.StartLine, source: source(start)}
+			report.reject(row, rejectMalformed, parseErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := whitelistRow{line: line, source: source(start)}
+		if len(record) < 3 {
+			report.reject(row, rejectMalformed, fmt.Sprintf("expected 3 columns, found %d", len(record)))
+			continue
+		}
+		row.Name = strings.TrimSpace(record[0])
+		row.Email = record[2]
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// validateWhitelist normalizes the email of each row and returns the rows
+// that can be added, rejecting the rest.
+func validateWhitelist(rows []whitelistRow, st store.Store, report *WhitelistReport) ([]whitelistRow, error) {
+	existing, err := st.ListWhitelist()
+	if err != nil {
+		return nil, err
+	}
+	whitelisted := make(map[string]bool, len(existing))
+	for _, entry := range existing {
+		whitelisted[emailKey(entry.Email)] = true
+	}
+
+	seen := make(map[string]int)
+	var valid []whitelistRow
+	for _, row := range rows {
+		email, err := mailaddr.Normalize(row.Email)
+		if err != nil {
+			report.reject(row, rejectEmail, err.Error())
+			continue
+		}
+		row.Email = email
+		key := emailKey(email)
+		if first, ok := seen[key]; ok {
+			report.reject(row, rejectDuplicate, "duplicate of line "+strconv.Itoa(first))
+			continue
+		}
+		seen[key] = row.line
+		if whitelisted[key] {
+			report.reject(row, rejectWhitelisted, rejectWhitelisted)
+			continue
+		}
+		valid = append(valid, row)
+	}
+	return valid, nil
+}
+
+// writeWhitelistRejects writes the rejected rows to filename in file
+// order and exactly as they appear in the source file, malformed or not,
+// with a reason column added, so they can be fixed and imported again. A
+// rejects file left by an earlier import is removed when there is nothing
+// to reject.
+func writeWhitelistRejects(filename string, report *WhitelistReport) error {
+	if len(report.rejects) == 0 {
+		if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sort.SliceStable(report.rejects, func(i, j int) bool {
+		return report.rejects[i].row.line < report.rejects[j].row.line
+	})
+	out := bufio.NewWriter(file)
+	fmt.Fprintf(out, "%s,reason\n", report.header)
+	for _, reject := range report.rejects {
+		fmt.Fprintf(out, "%s,%s\n", reject.row.source, csvField(reject.detail))
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// csvField quotes s as a csv field where it needs to be.
+func csvField(s string) string {
+	var field strings.Builder
+	writer := csv.NewWriter(&field)
+	writer.Write([]string{s})
+	writer.Flush()
+	return strings.TrimSuffix(field.String(), "\n")
+}
+
+func printWhitelistReport(report *WhitelistReport) {
+	table := newTable("Result", "Rows")
+	table.AddRow(green, "added, linked to a user", strconv.Itoa(report.Linked))
+	table.AddRow(green, "added, not registered yet", strconv.Itoa(report.Unlinked))
+	rejected := 0
+	for _, reason := range rejectReasons {
+		if count := report.Rejected[reason]; count > 0 {
+			table.AddRow(red, "rejected: "+reason, strconv.Itoa(count))
+			rejected += count
+		}
+	}
+	table.Footer = []string{"Total", strconv.Itoa(report.Linked + report.Unlinked + rejected)}
+	console.PrintTable(table)
+	if rejected > 0 {
+		console.Printf("%sRejected rows written to %s%s\n", yellow, whitelistRejectsFile, reset)
+	}
+}
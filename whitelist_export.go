@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// Statuses of a person in whitelist export and reconcile.
+const (
+	// statusLinked is a whitelist entry linked to the user who registered
+	// with its email.
+	statusLinked = "linked"
+	// statusUnlinked is a whitelist entry no user is linked to.
+	statusUnlinked = "unlinked"
+	// statusLinkable is an unlinked entry whose email a user has since
+	// registered with.
+	statusLinkable = "linkable"
+	// statusNotWhitelisted is a registered user with no whitelist entry.
+	statusNotWhitelisted = "not_whitelisted"
+)
+
+var whitelistColumns = []string{"email", "name", "status", "user_id"}
+
+// WhitelistExportRecord is a person as written by whitelist export and
+// reconcile.
+type WhitelistExportRecord struct {
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// parseExportArgs splits the arguments of whitelist export into the
+// --status filter and the file name.
+func parseExportArgs(args []string) (status, filename string, err error) {
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--status="):
+			status = strings.TrimPrefix(arg, "--status=")
+			if status != statusLinked && status != statusUnlinked {
+				return "", "", usageError{fmt.Sprintf("unknown status %s, want %s or %s", status, statusLinked, statusUnlinked)}
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return "", "", usageError{"unknown option " + arg}
+		case filename == "":
+			filename = arg
+		default:
+			return "", "", usageError{"too many arguments for export command"}
+		}
+	}
+	return status, filename, nil
+}
+
+// ExportWhitelist returns every whitelist entry, ordered by email, as
+// linked or unlinked. A non-empty status keeps only the entries that
+// have it.
+func ExportWhitelist(status string, st store.Store) ([]WhitelistExportRecord, error) {
+	entries, err := st.ListWhitelist()
+	if err != nil {
+		return nil, err
+	}
+	var records []WhitelistExportRecord
+	for _, entry := range entries {
+		record := WhitelistExportRecord{Email: entry.Email, Name: entry.Name, Status: statusUnlinked, UserID: entry.UserID}
+		if entry.UserID != "" {
+			record.Status = statusLinked
+		}
+		if status == "" || record.Status == status {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// ReconcileWhitelist compares the whitelist with the users table. It
+// returns every whitelist entry, as linked, unlinked or linkable when a
+// user has registered with its email since it was added, followed by the
+// users who are not on the whitelist at all.
+func ReconcileWhitelist(st store.Store) ([]WhitelistExportRecord, error) {
+	entries, err := st.ListWhitelist()
+	if err != nil {
+		return nil, err
+	}
+	users, err := st.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	usersByEmail := make(map[string]store.User, len(users))
+	for _, user := range users {
+		usersByEmail[emailKey(user.Email)] = user
+	}
+
+	whitelisted := make(map[string]bool, len(entries))
+	var records []WhitelistExportRecord
+	for _, entry := range entries {
+		record := WhitelistExportRecord{Email: entry.Email, Name: entry.Name, Status: statusUnlinked, UserID: entry.UserID}
+		if user, ok := usersByEmail[emailKey(entry.Email)]; ok && entry.UserID == "" {
+			record.Status = statusLinkable
+			record.UserID = user.ID
+		}
+		if entry.UserID != "" {
+			record.Status = statusLinked
+			whitelisted[entry.UserID] = true
+		}
+		whitelisted[emailKey(entry.Email)] = true
+		records = append(records, record)
+	}
+	for _, user := range users {
+		if !whitelisted[user.ID] && !whitelisted[emailKey(user.Email)] {
+			records = append(records, WhitelistExportRecord{Email: user.Email, Name: user.Name, Status: statusNotWhitelisted, UserID: user.ID})
+		}
+	}
+	return records, nil
+}
+
+// writeWhitelistRecords writes records to filename, as json when it ends
+// in .json and csv otherwise. An empty filename or "-" writes csv to
+// stdout.
+func writeWhitelistRecords(filename string, records []WhitelistExportRecord) error {
+	var out io.Writer = console.Out
+	if filename != "" && filename != "-" {
+		file, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if isJSONFile(filename) {
+		if records == nil {
+			records = []WhitelistExportRecord{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Write(whitelistColumns)
+	for _, record := range records {
+		writer.Write([]string{record.Email, record.Name, record.Status, record.UserID})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func printReconcileSummary(records []WhitelistExportRecord) {
+	counts := make(map[string]int)
+	for _, record := range records {
+		counts[record.Status]++
+	}
+	table := newTable("Status", "People")
+	table.AddRow(green, "whitelisted and registered ("+statusLinked+")", strconv.Itoa(counts[statusLinked]))
+	table.AddRow(yellow, "registered, not linked yet ("+statusLinkable+")", strconv.Itoa(counts[statusLinkable]))
+	table.AddRow("", "whitelisted, not registered ("+statusUnlinked+")", strconv.Itoa(counts[statusUnlinked]))
+	table.AddRow(red, "registered, not whitelisted ("+statusNotWhitelisted+")", strconv.Itoa(counts[statusNotWhitelisted]))
+	table.Footer = []string{"Total", strconv.Itoa(len(records))}
+	console.PrintTable(table)
+}
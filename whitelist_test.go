@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// inWhitelistDir runs the test from a temporary directory holding csv as
+// whitelist.csv.
+func inWhitelistDir(t *testing.T, csv string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, whitelistFile), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// A row the database rejects is named in the error, and nothing is added.
+func TestImportWhitelistNamesFailingRow(t *testing.T) {
+	db, st := openTestDB(t)
+	if _, err := db.Exec(`CREATE UNIQUE INDEX whitelists_name ON whitelists (name)`); err != nil {
+		t.Fatal(err)
+	}
+	dir := inWhitelistDir(t, "Name,Random,Email\nAlice,x,alice@example.com\nBob,y,bob@example.com\nAlice,z,alice2@example.com\n")
+
+	_, err := ImportWhitelist(filepath.Join(dir, whitelistFile), st)
+	want := "inserting into whitelist: alice2@example.com on line 4 of " + filepath.Join(dir, whitelistFile) + " already exists"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+	if entries, err := st.ListWhitelist(); err != nil || len(entries) != 0 {
+		t.Errorf("whitelist = %+v, %v; want nothing added", entries, err)
+	}
+}
+
+// Emails are matched however they are cased, and rows with invalid ones
+// are skipped.
+func TestAddWhitelistLinksUsers(t *testing.T) {
+	db, st := openTestDB(t)
+	user := addTestUser(t, db, "alice@example.com")
+	inWhitelistDir(t, "Name,Random,Email\nAlice,x, Alice@Example.com\nBob,y,bob@example.com\nEve,z,eve at example.com\n")
+
+	var err error
+	withStdio(t, "", func() { err = AddWhitelist(st) })
+	if err != nil {
+		t.Fatalf("AddWhitelist: %v", err)
+	}
+	entries, err := st.ListWhitelist()
+	if err != nil {
+		t.Fatalf("ListWhitelist: %v", err)
+	}
+	linked := map[string]string{}
+	for _, entry := range entries {
+		linked[entry.Email] = entry.UserID
+	}
+	want := map[string]string{"alice@example.com": user.ID, "bob@example.com": ""}
+	if len(linked) != len(want) {
+		t.Fatalf("whitelist = %+v, want entries for %v", entries, want)
+	}
+	for email, userID := range want {
+		if linked[email] != userID {
+			t.Errorf("%s linked to %q, want %q", email, linked[email], userID)
+		}
+	}
+}
+
+func TestAddWhitelistWritesRejects(t *testing.T) {
+	_, st := openTestDB(t)
+	if err := st.AddWhitelist(&store.Whitelist{Name: "Carol", Email: "carol@example.com"}); err != nil {
+		t.Fatalf("AddWhitelist: %v", err)
+	}
+	dir := inWhitelistDir(t, strings.Join([]string{
+		"Name,Random,Email",
+		"Bob,y,bob@example.com",
+		"Bobby,y,BOB@example.com",
+		"Carol,z,carol@example.com",
+		"Dave,only two",
+		"Eve,z,eve@",
+		`Frank,"unquoted,frank@example.com`,
+	}, "\n"))
+
+	var err error
+	output := withStdio(t, "", func() { err = AddWhitelist(st) })
+	if err != nil {
+		t.Fatalf("AddWhitelist: %v", err)
+	}
+	for _, want := range []string{
+		"| added, not registered yet     | 1    |",
+		"| rejected: malformed row       | 2    |",
+		"| rejected: invalid email       | 1    |",
+		"| rejected: duplicate in file   | 1    |",
+		"| rejected: already whitelisted | 1    |",
+		"| Total                         | 6    |",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("summary has no line %q:\n%s", want, output)
+		}
+	}
+
+	rejects, err := os.ReadFile(filepath.Join(dir, whitelistRejectsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"Name,Random,Email,reason",
+		"Bobby,y,BOB@example.com,duplicate of line 2",
+		"Carol,z,carol@example.com,already whitelisted",
+		"Dave,only two,\"expected 3 columns, found 2\"",
+		"Eve,z,eve@,\"invalid email \"\"eve@\"\"\"",
+		`Frank,"unquoted,frank@example.com,"expected 3 columns, found 2"`,
+		"",
+	}, "\n")
+	if string(rejects) != want {
+		t.Errorf("%s =\n%s\nwant\n%s", whitelistRejectsFile, rejects, want)
+	}
+}
+
+func TestImportWhitelistInBatches(t *testing.T) {
+	db, st := openTestDB(t)
+	var csv strings.Builder
+	csv.WriteString("Name,Random,Email\n")
+	for i := 0; i < 1234; i++ {
+		email := fmt.Sprintf("person%d@example.com", i)
+		if i%100 == 0 {
+			addTestUser(t, db, strings.ToUpper(email))
+		}
+		fmt.Fprintf(&csv, "Person %d,x,%s\n", i, email)
+	}
+	dir := inWhitelistDir(t, csv.String())
+
+	report, err := ImportWhitelist(filepath.Join(dir, whitelistFile), st)
+	if err != nil {
+		t.Fatalf("ImportWhitelist: %v", err)
+	}
+	if report.Linked != 13 || report.Unlinked != 1221 {
+		t.Errorf("linked %d and left %d unlinked, want 13 and 1221", report.Linked, report.Unlinked)
+	}
+	entries, err := st.ListWhitelist()
+	if err != nil {
+		t.Fatalf("ListWhitelist: %v", err)
+	}
+	if len(entries) != 1234 {
+		t.Errorf("%d entries whitelisted, want 1234", len(entries))
+	}
+}
+
+func TestReconcileWhitelist(t *testing.T) {
+	st := store.NewMemory()
+	alice := store.User{Base: store.NewBase(), Email: "alice@example.com", Name: "Alice"}
+	st.AddUser(alice)
+	st.AddUser(store.User{Email: "Bob@example.com", Name: "Bob"})
+	st.AddUser(store.User{Email: "carol@example.com", Name: "Carol"})
+	for _, entry := range []store.Whitelist{
+		{Name: "Alice", Email: "alice@example.com", UserID: alice.ID},
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Dave", Email: "dave@example.com"},
+	} {
+		if err := st.AddWhitelist(&entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := ReconcileWhitelist(st)
+	if err != nil {
+		t.Fatalf("ReconcileWhitelist: %v", err)
+	}
+	got := map[string]string{}
+	for _, record := range records {
+		got[record.Email] = record.Status
+	}
+	want := map[string]string{
+		"alice@example.com": statusLinked,
+		"bob@example.com":   statusLinkable,
+		"dave@example.com":  statusUnlinked,
+		"carol@example.com": statusNotWhitelisted,
+	}
+	if len(got) != len(want) {
+		t.Errorf("reconciled %v, want %v", got, want)
+	}
+	for email, status := range want {
+		if got[email] != status {
+			t.Errorf("%s is %q, want %q", email, got[email], status)
+		}
+	}
+
+	unlinked, err := ExportWhitelist(statusUnlinked, st)
+	if err != nil {
+		t.Fatalf("ExportWhitelist: %v", err)
+	}
+	if len(unlinked) != 2 || unlinked[0].Email != "bob@example.com" || unlinked[1].Email != "dave@example.com" {
+		t.Errorf("unlinked entries = %+v, want bob and dave", unlinked)
+	}
+}
+
+func TestWatchWhitelistLinksNewUsers(t *testing.T) {
+	db, st := openTestDB(t)
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		if err := st.AddWhitelist(&store.Whitelist{Name: email, Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user := addTestUser(t, db, "Alice@Example.com")
+
+	// A cancelled context stops the watch after its first pass.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var linked int
+	var err error
+	output := withStdio(t, "", func() { linked, err = WatchWhitelist(ctx, st, time.Hour) })
+	if err != nil {
+		t.Fatalf("WatchWhitelist: %v", err)
+	}
+	if linked != 1 || !strings.Contains(output, "Linked alice@example.com to user "+user.ID) {
+		t.Errorf("linked %d entries, want alice's:\n%s", linked, output)
+	}
+	entries, err := st.ListWhitelist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if want := map[string]string{"alice@example.com": user.ID}[entry.Email]; entry.UserID != want {
+			t.Errorf("%s linked to %q, want %q", entry.Email, entry.UserID, want)
+		}
+	}
+}
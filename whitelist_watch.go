@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/qwerty-dvorak/gocli/store"
+)
+
+// watchInterval is how often whitelist watch checks for new users by
+// default.
+const watchInterval = 5 * time.Second
+
+// parseWatchArgs reads the --interval option of whitelist watch.
+func parseWatchArgs(args []string) (time.Duration, error) {
+	interval := watchInterval
+	for _, arg := range args {
+		value, ok := strings.CutPrefix(arg, "--interval=")
+		if !ok {
+			return 0, usageError{"unknown option " + arg}
+		}
+		var err error
+		interval, err = time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return 0, usageError{"invalid interval " + value + ", e.g. --interval=10s"}
+		}
+	}
+	return interval, nil
+}
+
+// runWhitelistWatch links whitelist entries to users as they register,
+// until interrupted with Ctrl-C or stopped with SIGTERM, as a service
+// manager or docker stop does.
+func runWhitelistWatch(st store.Store, interval time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	console.Printf("%sWatching for new users every %v, press Ctrl-C to stop%s\n", cyan, interval, reset)
+	linked, err := WatchWhitelist(ctx, st, interval)
+	console.Printf("%sStopped watching, %d whitelist entries linked%s\n", cyan, linked, reset)
+	return err
+}
+
+// WatchWhitelist links the whitelist entries of users who registered
+// after they were whitelisted, then again every interval until ctx is
+// done. It polls rather than using LISTEN/NOTIFY so that it needs no
+// trigger on the users table and works on every backend. It returns how
+// many entries it linked.
+func WatchWhitelist(ctx context.Context, st store.Store, interval time.Duration) (int, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	total := 0
+	for {
+		entries, err := st.LinkWhitelist()
+		if err != nil {
+			return total, fmt.Errorf("linking whitelist: %w", err)
+		}
+		for _, entry := range entries {
+			slog.Info("linked whitelist entry", "email", entry.Email, "name", entry.Name, "user_id", entry.UserID)
+			console.Printf("%s%s Linked %s to user %s%s\n", green, time.Now().Format(time.TimeOnly), entry.Email, entry.UserID, reset)
+		}
+		total += len(entries)
+
+		select {
+		case <-ctx.Done():
+			return total, nil
+		case <-ticker.C:
+		}
+	}
+}